@@ -15,16 +15,36 @@
 package main
 
 import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"html"
 	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	pathpkg "path"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
+	"text/template"
+	"time"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
 )
 
 var (
@@ -35,6 +55,7 @@ var (
 func reportError(err interface{}) bool {
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		runLog.addError(err)
 		return true
 	}
 	return false
@@ -48,9 +69,57 @@ func reportWarning(err interface{}) bool {
 	return false
 }
 
+// Exit codes reported for different failure categories.
+const (
+	exitGeneric = 1 // any failure not covered by other codes
+	exitNoInput = 2 // no bookmarks files found
+	exitParse   = 3 // bookmarks file could not be parsed
+	exitIO      = 4 // reading input or writing output failed
+)
+
+// exitError is an error carrying exit code it should be reported with.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// exitCode returns exit code for the given failure.
+func exitCode(err interface{}) int {
+	e, ok := err.(error)
+	if !ok {
+		return exitGeneric
+	}
+
+	var ee *exitError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var pathErr *fs.PathError
+	var linkErr *os.LinkError
+	var syscallErr *os.SyscallError
+	switch {
+	case errors.As(e, &ee):
+		return ee.code
+	case errors.As(e, &syntaxErr), errors.As(e, &typeErr), errors.Is(e, zip.ErrFormat):
+		return exitParse
+	case errors.As(e, &pathErr), errors.As(e, &linkErr), errors.As(e, &syscallErr), errors.Is(e, io.ErrUnexpectedEOF), errors.Is(e, io.ErrShortWrite):
+		return exitIO
+	default:
+		return exitGeneric
+	}
+}
+
 func fatal(err interface{}) {
 	if reportError(err) {
-		os.Exit(1)
+		runLog.write(exitCode(err))
+		os.Exit(exitCode(err))
 	}
 }
 
@@ -101,14 +170,166 @@ func (nc stdoutWrapper) Close() error {
 	return nil
 }
 
-func makeOutput(path string) (WriteSyncCloser, error) {
+// makeOutput returns writer for the given output path, or stdout when path is
+// empty. Non zero mode sets permissions of the file, also when it already
+// exists.
+func makeOutput(path string, mode os.FileMode) (WriteSyncCloser, error) {
 	if path == "" {
 		return stdoutWrapper{os.Stdout}, nil
 	}
-	return os.Create(path)
+	return createFile(path, mode)
+}
+
+func createFile(path string, mode os.FileMode) (*os.File, error) {
+	if mode == 0 {
+		return os.Create(path)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// wrapOutput applies output encoding and size limit to the given writer.
+func wrapOutput(w WriteSyncCloser, cfg *config) (WriteSyncCloser, error) {
+	w, err := encodeOutput(w, cfg.outputEncoding)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.previewLines > 0 {
+		w = &previewWriter{WriteSyncCloser: w, lines: cfg.previewLines}
+	}
+	if cfg.maxBytes > 0 {
+		w = &limitedWriter{WriteSyncCloser: w, limit: cfg.maxBytes}
+	}
+	if cfg.flushInterval > 0 {
+		w = &flushingWriter{WriteSyncCloser: w, interval: cfg.flushInterval}
+	}
+	return w, nil
+}
+
+// flushingWriter syncs the underlying writer after every interval lines, so
+// that partial output survives an interrupted conversion. Sync is invoked
+// only at line boundaries.
+type flushingWriter struct {
+	WriteSyncCloser
+	interval int
+	lines    int // lines written since the last sync
+}
+
+func (fw *flushingWriter) Write(p []byte) (int, error) {
+	n, err := fw.WriteSyncCloser.Write(p)
+	if err != nil {
+		return n, err
+	}
+	fw.lines += bytes.Count(p, []byte("\n"))
+	if fw.lines >= fw.interval && bytes.HasSuffix(p, []byte("\n")) {
+		fw.lines = 0
+		if err := fw.WriteSyncCloser.Sync(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// previewWriter passes through only the given number of lines, silently
+// discarding all further content.
+type previewWriter struct {
+	WriteSyncCloser
+	lines int // lines left to write
+}
+
+func (pw *previewWriter) Write(p []byte) (int, error) {
+	if pw.lines == 0 {
+		return len(p), nil
+	}
+	out := p
+	for i, c := range p {
+		if c == '\n' {
+			pw.lines--
+			if pw.lines == 0 {
+				out = p[:i+1]
+				break
+			}
+		}
+	}
+	if _, err := pw.WriteSyncCloser.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// limitedWriter passes through only complete lines, as long as their total
+// size does not exceed the limit. Once a line does not fit, truncation notice
+// is written and all further content is discarded.
+type limitedWriter struct {
+	WriteSyncCloser
+	limit     int64
+	written   int64
+	line      []byte // incomplete line
+	truncated bool
+}
+
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	for rest := p; len(rest) > 0 && !lw.truncated; {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			lw.line = append(lw.line, rest...)
+			break
+		}
+		lw.line = append(lw.line, rest[:i+1]...)
+		rest = rest[i+1:]
+		if err := lw.flushLine(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (lw *limitedWriter) flushLine() error {
+	if len(lw.line) == 0 || lw.truncated {
+		return nil
+	}
+	line := lw.line
+	lw.line = nil
+	if lw.written+int64(len(line)) > lw.limit {
+		lw.truncated = true
+		_, err := fmt.Fprintf(lw.WriteSyncCloser, "\n[output truncated after %d bytes]\n", lw.written)
+		return err
+	}
+	lw.written += int64(len(line))
+	_, err := lw.WriteSyncCloser.Write(line)
+	return err
+}
+
+func (lw *limitedWriter) Sync() error {
+	if err := lw.flushLine(); err != nil {
+		return err
+	}
+	return lw.WriteSyncCloser.Sync()
 }
 
-func findAllBookmarksFiles(path string, maxDepth int) ([]string, error) {
+// findAllBookmarksFiles returns paths of all Bookmarks files found within the
+// given directory, descending at most maxDepth levels. When visited is not nil,
+// symbolic links to directories are followed and visited holds real paths of
+// already traversed directories, to avoid cycles.
+func findAllBookmarksFiles(path string, maxDepth int, visited map[string]bool) ([]string, error) {
+	if visited != nil {
+		real, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return nil, err
+		}
+		if visited[real] {
+			return nil, nil
+		}
+		visited[real] = true
+	}
+
 	entries, err := os.ReadDir(path)
 	if err != nil {
 		return nil, err
@@ -126,8 +347,8 @@ func findAllBookmarksFiles(path string, maxDepth int) ([]string, error) {
 	res := []string(nil)
 	for _, e := range entries {
 		name := e.Name()
-		if e.IsDir() {
-			li, err := findAllBookmarksFiles(filepath.Join(path, name), maxDepth-1)
+		if e.IsDir() || (visited != nil && isSymlinkToDir(filepath.Join(path, name), e)) {
+			li, err := findAllBookmarksFiles(filepath.Join(path, name), maxDepth-1, visited)
 			reportError(err)
 			res = append(res, li...)
 		} else if name == "Bookmarks" {
@@ -138,129 +359,4500 @@ func findAllBookmarksFiles(path string, maxDepth int) ([]string, error) {
 	return res, nil
 }
 
+func isSymlinkToDir(path string, e fs.DirEntry) bool {
+	if e.Type()&fs.ModeSymlink == 0 {
+		return false
+	}
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
+
 func writef(w io.Writer, format string, args ...interface{}) error {
 	_, err := fmt.Fprintf(w, format, args...)
 	return err
 }
 
 type bookmarks struct {
-	Version int                        `json:"version"`
-	Roots   map[string]*bookmarksEntry `json:"roots"`
+	Version      int                        `json:"version"`
+	Checksum     string                     `json:"checksum"`
+	SyncMetadata string                     `json:"sync_metadata"`
+	Roots        map[string]*bookmarksEntry `json:"roots"`
+
+	order    []string // explicit order of roots, overrides the default one
+	sections bool     // roots are rendered as section headings, where supported
+	flat     bool     // roots are not rendered, only their children
+	barTop   bool     // children of bookmarks bar root are rendered in place of it
 }
 
 type bookmarksEntry struct {
-	Name     string `json:"name"`
-	Type     string `json:"type"`
-	Url      string `json:"url"`
-	Children []*bookmarksEntry
+	Name         string            `json:"name"`
+	Type         string            `json:"type"`
+	Url          string            `json:"url"`
+	Id           string            `json:"id"`
+	Guid         string            `json:"guid"`
+	DateAdded    string            `json:"date_added"`
+	DateModified string            `json:"date_modified"`
+	DateLastUsed string            `json:"date_last_used"`
+	MetaInfo     map[string]string `json:"meta_info"`
+	Children     []*bookmarksEntry
+
+	mergedFrom []string // names of profiles that contributed to merged folder
+	breadcrumb []string // path of folders shown in front of the entry in flat output
+	index      int      // 1-based position among siblings in the bookmarks file
+	execResult string   // outcome of external command run for the bookmark
+	omitted    int      // number of children removed by capChildren
 }
 
-func convertBookmarksFile(w io.Writer, bookmarksFile string, profileName string, indent string) error {
-	bookmarksData, err := os.ReadFile(bookmarksFile)
-	if err != nil {
-		return err
+// chromeEpochOffset is the number of seconds between Chrome's time epoch
+// (1601-01-01 UTC) and the Unix epoch.
+const chromeEpochOffset = 11644473600
+
+// chromeTimeToTime converts Chrome timestamp (number of microseconds since
+// 1601-01-01 UTC, stored as a decimal string) to time. It returns false for
+// empty, zero or malformed timestamps.
+func chromeTimeToTime(v string) (time.Time, bool) {
+	us, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || us <= 0 {
+		return time.Time{}, false
+	}
+	return time.UnixMicro(us - chromeEpochOffset*1000000).UTC(), true
+}
+
+// bookmarksEntryV2 is the entry layout accepted for version 2 files. It is a
+// stub for a possible future format: besides "children", nested entries are
+// accepted under "nodes", a speculative alias for the case the key is renamed.
+type bookmarksEntryV2 struct {
+	Name         string              `json:"name"`
+	Type         string              `json:"type"`
+	Url          string              `json:"url"`
+	Id           string              `json:"id"`
+	Guid         string              `json:"guid"`
+	DateAdded    string              `json:"date_added"`
+	DateModified string              `json:"date_modified"`
+	DateLastUsed string              `json:"date_last_used"`
+	MetaInfo     map[string]string   `json:"meta_info"`
+	Children     []*bookmarksEntryV2 `json:"children"`
+	Nodes        []*bookmarksEntryV2 `json:"nodes"`
+}
+
+func (e *bookmarksEntryV2) toV1() *bookmarksEntry {
+	res := &bookmarksEntry{Name: e.Name, Type: e.Type, Url: e.Url, Id: e.Id, Guid: e.Guid, DateAdded: e.DateAdded, DateModified: e.DateModified, DateLastUsed: e.DateLastUsed, MetaInfo: e.MetaInfo}
+	for _, c := range append(e.Children, e.Nodes...) {
+		if c != nil {
+			res.Children = append(res.Children, c.toV1())
+		}
+	}
+	return res
+}
+
+// unmarshalJson decodes data into v. With strict set, unknown fields are
+// reported as errors.
+func unmarshalJson(data []byte, v interface{}, strict bool) error {
+	if !strict {
+		return json.Unmarshal(data, v)
 	}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+	return d.Decode(v)
+}
 
+func parseBookmarksV1(data []byte, strict bool) (*bookmarks, error) {
 	b := &bookmarks{}
-	if err := json.Unmarshal(bookmarksData, b); err != nil {
-		return err
+	if err := unmarshalJson(data, b, strict); err != nil {
+		return nil, err
 	}
+	return b, nil
+}
 
-	if b.Version != 1 {
-		reportWarning(fmt.Sprintf("bookmarks file %s: unknown version %d, expected 1", bookmarksFile, b.Version))
+func parseBookmarksV2(data []byte, strict bool) (*bookmarks, error) {
+	b := &struct {
+		Version      int                          `json:"version"`
+		Checksum     string                       `json:"checksum"`
+		SyncMetadata string                       `json:"sync_metadata"`
+		Roots        map[string]*bookmarksEntryV2 `json:"roots"`
+	}{}
+	if err := unmarshalJson(data, b, strict); err != nil {
+		return nil, err
+	}
+	res := &bookmarks{Version: b.Version, Checksum: b.Checksum, SyncMetadata: b.SyncMetadata, Roots: map[string]*bookmarksEntry{}}
+	for k, e := range b.Roots {
+		if e != nil {
+			res.Roots[k] = e.toV1()
+		}
 	}
+	return res, nil
+}
 
-	if err := writef(w, "## Profile %s\n", profileName); err != nil {
-		return err
+// parseBookmarks decodes bookmarks file content, dispatching on its version.
+// Unknown versions are parsed on a best-effort basis using the version 1
+// layout.
+func parseBookmarks(data []byte, bookmarksFile string) (*bookmarks, error) {
+	return decodeBookmarks(data, bookmarksFile, false)
+}
+
+// parseStrictBookmarks decodes bookmarks file content like parseBookmarks, but
+// fields not known to this tool are reported as errors.
+func parseStrictBookmarks(data []byte, bookmarksFile string) (*bookmarks, error) {
+	b, err := decodeBookmarks(data, bookmarksFile, true)
+	if err != nil && isUnknownFieldError(err) {
+		return nil, &exitError{exitParse, fmt.Errorf("bookmarks file %s: %w", bookmarksFile, err)}
 	}
-	for _, entry := range b.Roots {
-		if err := convertBookmarksEntry(w, entry, "", indent); err != nil {
-			return err
+	return b, err
+}
+
+// isUnknownFieldError reports whether err was returned by json.Decoder with
+// disallowed unknown fields upon encountering one. The decoder does not export
+// a dedicated error type, so the error is recognized by its message.
+func isUnknownFieldError(err error) bool {
+	return strings.HasPrefix(err.Error(), `json: unknown field "`)
+}
+
+func decodeBookmarks(data []byte, bookmarksFile string, strict bool) (*bookmarks, error) {
+	header := struct {
+		Version int `json:"version"`
+	}{}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, err
+	}
+
+	switch header.Version {
+	case 1:
+		return parseBookmarksV1(data, strict)
+	case 2:
+		return parseBookmarksV2(data, strict)
+	default:
+		reportWarning(fmt.Sprintf("bookmarks file %s: unknown version %d, expected 1 or 2", bookmarksFile, header.Version))
+		return parseBookmarksV1(data, strict)
+	}
+}
+
+// chromeChecksum computes checksum of bookmarks the way Chrome does when
+// writing Bookmarks file. It is a hex encoded MD5 digest of all entries of
+// bookmark_bar, other and synced roots (in that order, roots included), visited
+// depth first. For every entry its id, name (encoded as UTF-16LE) and type
+// ("url" or "folder") are hashed, followed by URL for bookmarks. Values are
+// concatenated without any separators.
+func chromeChecksum(b *bookmarks) string {
+	h := md5.New()
+	var update func(e *bookmarksEntry)
+	update = func(e *bookmarksEntry) {
+		io.WriteString(h, e.Id)
+		for _, u := range utf16.Encode([]rune(e.Name)) {
+			h.Write([]byte{byte(u), byte(u >> 8)})
+		}
+		if isUrlEntry(e) {
+			io.WriteString(h, "url")
+			io.WriteString(h, e.Url)
+			return
+		}
+		io.WriteString(h, "folder")
+		for _, c := range e.Children {
+			update(c)
 		}
 	}
-	return writef(w, "\n")
+	for _, k := range rootsOrder {
+		if r := b.Roots[k]; r != nil {
+			update(r)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
 }
 
-func convertBookmarksEntries(w io.Writer, entries []*bookmarksEntry, prefix, indent string) error {
-	for _, e := range entries {
-		if err := convertBookmarksEntry(w, e, prefix, indent); err != nil {
-			return err
+// verifyChecksum reports a warning when checksum stored in bookmarks file does
+// not match its content.
+func verifyChecksum(b *bookmarks, bookmarksFile string) {
+	if b.Checksum == "" {
+		reportWarning(fmt.Sprintf("bookmarks file %s: no checksum stored, content cannot be verified", bookmarksFile))
+		return
+	}
+	if sum := chromeChecksum(b); !strings.EqualFold(sum, b.Checksum) {
+		reportWarning(fmt.Sprintf("bookmarks file %s: checksum mismatch, stored %s but content has %s, the file may be corrupted or modified outside of Chrome", bookmarksFile, b.Checksum, sum))
+	}
+}
+
+// rootsOrder lists the well known roots in the order Chrome displays them.
+var rootsOrder = []string{"bookmark_bar", "other", "synced"}
+
+// rootKeys returns keys of non empty roots of the given bookmarks in a stable
+// order: explicit order if set, otherwise well known roots first, followed by
+// any other roots sorted by key.
+func rootKeys(b *bookmarks) []string {
+	res := []string(nil)
+	if b.order != nil {
+		for _, k := range b.order {
+			if b.Roots[k] != nil {
+				res = append(res, k)
+			}
 		}
+		return res
 	}
-	return nil
+	for _, k := range rootsOrder {
+		if b.Roots[k] != nil {
+			res = append(res, k)
+		}
+	}
+	rest := []string(nil)
+	for k, e := range b.Roots {
+		if !isWellKnownRoot(k) && e != nil {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	return append(res, rest...)
 }
 
-func convertBookmarksEntry(w io.Writer, entry *bookmarksEntry, prefix, indent string) error {
-	if entry.Type == "url" || entry.Url != "" {
-		if err := writef(w, "%s- [%s](%s)\n", prefix, entry.Name, entry.Url); err != nil {
-			return err
+func isWellKnownRoot(key string) bool {
+	for _, k := range rootsOrder {
+		if k == key {
+			return true
 		}
-	} else {
-		if err := writef(w, "%s- %s\n", prefix, entry.Name); err != nil {
-			return err
+	}
+	return false
+}
+
+// rootEntries returns roots of the given bookmarks in order of rootKeys.
+func rootEntries(b *bookmarks) []*bookmarksEntry {
+	res := []*bookmarksEntry(nil)
+	for _, k := range rootKeys(b) {
+		res = append(res, b.Roots[k])
+	}
+	return res
+}
+
+// topEntries returns entries rendered at the top level: roots, or children of
+// all roots for flat bookmarks.
+func topEntries(b *bookmarks) []*bookmarksEntry {
+	if b.barTop && !b.flat {
+		res := []*bookmarksEntry(nil)
+		for _, k := range rootKeys(b) {
+			if k == "bookmark_bar" {
+				res = append(res, b.Roots[k].Children...)
+			} else {
+				res = append(res, b.Roots[k])
+			}
 		}
+		return res
 	}
-	return convertBookmarksEntries(w, entry.Children, prefix+indent, indent)
+	if !b.flat {
+		return rootEntries(b)
+	}
+	res := []*bookmarksEntry(nil)
+	for _, r := range rootEntries(b) {
+		res = append(res, r.Children...)
+	}
+	return res
 }
 
-func showVersion() {
-	fmt.Printf("Version of application: %s, commit: %s\n", Version, Commit)
-	fmt.Printf("\n")
-	fmt.Printf("Copyright 2022 Marek Dalewski. License: Apache License 2.0\n")
-	fmt.Printf("\n")
-	fmt.Printf("You should have received a copy of the Apache License 2.0 along with this program. If not, see <https://www.apache.org/licenses/LICENSE-2.0>.\n")
+// topOmitted returns number of entries removed by capChildren from entries
+// returned by topEntries.
+func topOmitted(b *bookmarks) int {
+	if b.barTop && !b.flat {
+		return b.Roots["bookmark_bar"].omitted
+	}
+	if !b.flat {
+		return 0
+	}
+	res := 0
+	for _, r := range rootEntries(b) {
+		res += r.omitted
+	}
+	return res
 }
 
-func main() {
-	defaultInput, _ := defaultChromeConfigLocation() // on error user should provide path with flag
+// breadcrumb returns path of folders shown in front of the entry, separated
+// and terminated with the given separator, or empty string.
+func breadcrumb(entry *bookmarksEntry, sep string) string {
+	if len(entry.breadcrumb) == 0 {
+		return ""
+	}
+	return strings.Join(entry.breadcrumb, sep) + sep
+}
 
-	input := flag.String("input", defaultInput, "path containing Chrome configuration")
-	output := flag.String("output", "", "output path for storing generated document, leave empty for stdout")
-	profiles := flag.String("profiles", "", "comma separated list of profile names that should be included in output, leave empty for all profiles")
-	indent := flag.String("indent", "\\t", "string used for indentation")
-	version := flag.Bool("version", false, "show version information")
-	flag.Parse()
+// bookmarksParser parses content of bookmarks file.
+type bookmarksParser func(data []byte, bookmarksFile string) (*bookmarks, error)
 
-	if *version {
-		showVersion()
-		os.Exit(0)
+// bookmarksSource describes a single bookmarks file to convert.
+type bookmarksSource struct {
+	profile string                 // profile name used in output
+	path    string                 // location of the file, used in messages
+	origin  string                 // absolute location of the file or "stdin"
+	read    func() ([]byte, error) // reads file content
+	parse   bookmarksParser        // parses file content, nil for Chrome bookmarks file
+	local   bool                   // read from file system, reading can be retried
+}
+
+func (s bookmarksSource) load() (*bookmarks, error) {
+	bookmarksData, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	if s.parse != nil {
+		return s.parse(bookmarksData, s.path)
 	}
+	return parseBookmarks(bookmarksData, s.path)
+}
 
-	*input = filepath.Clean(*input)
+func absPath(path string) string {
+	if p, err := filepath.Abs(path); err == nil {
+		return p
+	}
+	return path
+}
 
-	if *profiles != "" {
-		*profiles = strings.ReplaceAll(*profiles, string(os.PathSeparator), "/")
-		*profiles = strings.ReplaceAll(*profiles, "/,", ",")
-		*profiles = strings.ReplaceAll(*profiles, ",/", ",")
-		*profiles = "," + *profiles + ","
+func fileSource(profile, path string) bookmarksSource {
+	return bookmarksSource{
+		profile: profile,
+		path:    path,
+		origin:  absPath(path),
+		read:    func() ([]byte, error) { return os.ReadFile(path) },
+		local:   true,
 	}
+}
 
-	*indent = strings.ReplaceAll(*indent, "\\t", "\t")
-	*indent = strings.ReplaceAll(*indent, "\\n", "\n")
-	*indent = strings.ReplaceAll(*indent, "\\r", "\r")
+// withRetries calls fn until it succeeds or fails retries more times, waiting
+// delay before the first retry and doubling it before every next one. Errors
+// reporting missing files are not retried.
+func withRetries(retries int, delay time.Duration, what string, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= retries || errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		reportWarning(fmt.Sprintf("%s failed, retrying in %s: %v", what, delay, err))
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
 
-	out, err := makeOutput(*output)
-	fatal(err)
-	defer out.Close()
+// retryingRead returns read function of the given source that retries failed
+// reads as described in withRetries.
+func retryingRead(src bookmarksSource, retries int, delay time.Duration) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		data := []byte(nil)
+		err := withRetries(retries, delay, "reading "+src.path, func() error {
+			var err error
+			data, err = src.read()
+			return err
+		})
+		return data, err
+	}
+}
 
-	bookmarksFiles, err := findAllBookmarksFiles(*input, 25)
-	fatal(err)
-	sort.Strings(bookmarksFiles)
+// findDirectorySources returns sources for all Bookmarks files found within
+// the given directory. When path points at a regular file, it is converted
+// directly as a single profile, named after its directory for files named
+// Bookmarks and after the file itself otherwise.
+func findDirectorySources(path string, maxDepth int, followSymlinks bool) ([]bookmarksSource, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		if filepath.Base(path) == "Bookmarks" {
+			name = filepath.Base(filepath.Dir(absPath(path)))
+		}
+		return []bookmarksSource{fileSource(name, path)}, nil
+	}
 
-	if len(bookmarksFiles) == 0 {
-		os.Exit(0)
+	visited := map[string]bool(nil)
+	if followSymlinks {
+		visited = map[string]bool{}
 	}
+	bookmarksFiles, err := findAllBookmarksFiles(path, maxDepth, visited)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(bookmarksFiles)
 
-	fatal(writef(out, "# Chrome bookmarks\n"))
-	fatal(writef(out, "\n"))
-	fatal(writef(out, "> This document was automatically generated by [chrome-bookmarks-to-markdown](https://github.com/daishe/chrome-bookmarks-to-markdown).\n"))
-	fatal(writef(out, "\n"))
+	res := make([]bookmarksSource, 0, len(bookmarksFiles))
 	for _, b := range bookmarksFiles {
-		p := strings.TrimSuffix(strings.TrimPrefix(b, *input+string(os.PathSeparator)), string(os.PathSeparator)+"Bookmarks")
-		if *profiles != "" && !strings.Contains(*profiles, ","+p+",") {
+		p := strings.TrimSuffix(strings.TrimPrefix(b, path+string(os.PathSeparator)), string(os.PathSeparator)+"Bookmarks")
+		res = append(res, fileSource(p, b))
+	}
+	return res, nil
+}
+
+// inputPaths splits the given input into paths separated with commas, unless
+// the whole input names an existing file or directory.
+func inputPaths(input string) []string {
+	if _, err := os.Stat(input); err == nil || !strings.Contains(input, ",") {
+		return []string{input}
+	}
+	res := []string(nil)
+	for _, p := range strings.Split(input, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			res = append(res, filepath.Clean(p))
+		}
+	}
+	return res
+}
+
+// findInputsSources returns sources of bookmarks files found in all the given
+// paths, in order of paths. Files reachable through more than one path (like
+// nested paths or symbolic links) are returned once. With more than one path,
+// profile names are prefixed with base name of their path, like
+// backup/Default, and names still shared by profiles are reported as errors.
+func findInputsSources(paths []string, maxDepth int, followSymlinks bool) ([]bookmarksSource, error) {
+	res, seen, names := []bookmarksSource(nil), map[string]bool{}, map[string]string{}
+	for _, p := range paths {
+		sources, err := findDirectorySources(p, maxDepth, followSymlinks)
+		if err != nil {
+			return nil, err
+		}
+		for _, src := range sources {
+			key := src.origin
+			if resolved, err := filepath.EvalSymlinks(key); err == nil {
+				key = resolved
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if len(paths) > 1 {
+				src.profile = filepath.Base(absPath(p)) + "/" + src.profile
+				if other, ok := names[src.profile]; ok {
+					return nil, fmt.Errorf("profile name %q is shared by bookmarks files %s and %s, inputs have to differ in their base names", src.profile, other, src.path)
+				}
+				names[src.profile] = src.path
+			}
+			res = append(res, src)
+		}
+	}
+	return res, nil
+}
+
+// globSources returns sources for all files matching the given glob pattern.
+// Profile of each source is named after the file name, without extension.
+func globSources(pattern string) ([]bookmarksSource, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid glob pattern %q: %w", pattern, err)
+	}
+	sort.Strings(matches)
+
+	res := make([]bookmarksSource, 0, len(matches))
+	for _, m := range matches {
+		if info, err := os.Stat(m); err != nil || info.IsDir() {
 			continue
 		}
-		fatal(convertBookmarksFile(out, b, p, *indent))
+		base := filepath.Base(m)
+		res = append(res, fileSource(strings.TrimSuffix(base, filepath.Ext(base)), m))
+	}
+	return res, nil
+}
+
+// recursiveGlobSources returns sources for all files matching the given
+// pattern, in which ** matches any number (including zero) of directories. Each
+// file becomes a profile named after its path relative to the directory the
+// pattern starts at, with Bookmarks files named after their directories.
+func recursiveGlobSources(pattern string) ([]bookmarksSource, error) {
+	segments := strings.Split(filepath.ToSlash(pattern), "/")
+	for _, s := range segments {
+		if _, err := pathpkg.Match(s, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob pattern %q: %w", pattern, err)
+		}
+	}
+	static := 0
+	for static < len(segments)-1 && !strings.ContainsAny(segments[static], "*?[\\") {
+		static++
+	}
+	root := filepath.FromSlash(strings.Join(segments[:static], "/"))
+	if static > 0 && root == "" {
+		root = string(filepath.Separator) // pattern starts with /
+	}
+	if root == "" {
+		root = "."
+	}
+
+	res := []bookmarksSource(nil)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			reportWarning(err)
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !matchGlobSegments(segments[static:], strings.Split(rel, "/")) {
+			return nil
+		}
+		name := strings.TrimSuffix(rel, pathpkg.Ext(rel))
+		if pathpkg.Base(rel) == "Bookmarks" && pathpkg.Dir(rel) != "." {
+			name = pathpkg.Dir(rel)
+		}
+		res = append(res, fileSource(name, path))
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return res, nil
+}
+
+// matchGlobSegments reports whether path segments match pattern segments, in
+// which ** matches any number of path segments.
+func matchGlobSegments(pattern, path []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(path); i++ {
+				if matchGlobSegments(pattern[1:], path[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(path) == 0 {
+			return false
+		}
+		if ok, _ := pathpkg.Match(pattern[0], path[0]); !ok {
+			return false
+		}
+		pattern, path = pattern[1:], path[1:]
+	}
+	return len(path) == 0
+}
+
+// stdinSource returns source reading bookmarks file content from stdin.
+func stdinSource() bookmarksSource {
+	return bookmarksSource{
+		profile: "stdin",
+		path:    "stdin",
+		origin:  "stdin",
+		read:    func() ([]byte, error) { return io.ReadAll(os.Stdin) },
+	}
+}
+
+// urlSource returns source downloading bookmarks file from the given HTTP(S)
+// URL. Profile name is derived from the URL host and path.
+func urlSource(rawUrl string, timeout time.Duration) (bookmarksSource, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return bookmarksSource{}, err
+	}
+	client := &http.Client{Timeout: timeout}
+	return bookmarksSource{
+		profile: strings.TrimSuffix(u.Host+u.Path, "/Bookmarks"),
+		path:    rawUrl,
+		origin:  rawUrl,
+		read: func() ([]byte, error) {
+			resp, err := client.Get(rawUrl)
+			if err != nil {
+				return nil, err
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return nil, &exitError{exitIO, fmt.Errorf("downloading %s: unexpected response status %s", rawUrl, resp.Status)}
+			}
+			return io.ReadAll(resp.Body)
+		},
+	}, nil
+}
+
+func isUrlInput(input string) bool {
+	return strings.HasPrefix(input, "http://") || strings.HasPrefix(input, "https://")
+}
+
+// findZipSources returns sources for all Bookmarks files stored in the given
+// zip archive. Profile names are derived from directories inside the archive.
+// Returned closer must be closed once all sources have been read.
+func findZipSources(path string) ([]bookmarksSource, io.Closer, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return zipSources(path, &r.Reader), r, nil
+}
+
+func zipSources(path string, r *zip.Reader) []bookmarksSource {
+	res := []bookmarksSource(nil)
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() || pathpkg.Base(f.Name) != "Bookmarks" {
+			continue
+		}
+		p := strings.Trim(pathpkg.Dir(f.Name), "/")
+		if p == "." {
+			p = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+		f := f
+		res = append(res, bookmarksSource{
+			profile: p,
+			path:    path + ":" + f.Name,
+			origin:  absPath(path) + ":" + f.Name,
+			read: func() ([]byte, error) {
+				rc, err := f.Open()
+				if err != nil {
+					return nil, err
+				}
+				defer rc.Close()
+				return io.ReadAll(rc)
+			},
+		})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].profile < res[j].profile })
+	return res
+}
+
+func isUrlEntry(entry *bookmarksEntry) bool {
+	return entry.Type == "url"
+}
+
+// resolveUrlEntries reports entries that have both URL and children. When
+// byUrlField is set, every entry with non-empty URL is turned into a bookmark,
+// regardless of its type.
+func resolveUrlEntries(b *bookmarks, byUrlField bool, bookmarksFile string) {
+	walkBookmarks(b, func(e *bookmarksEntry, depth int) {
+		if e.Url != "" && len(e.Children) != 0 {
+			reportWarning(fmt.Sprintf("bookmarks file %s: entry %q of type %q has both URL and children", bookmarksFile, e.Name, e.Type))
+		}
+		if byUrlField && e.Url != "" {
+			e.Type = "url"
+		}
+	})
+}
+
+// urlProblem returns description of what makes the given bookmark URL
+// malformed, or empty string for well formed URLs. No network access is done.
+func urlProblem(rawUrl string) string {
+	if strings.TrimSpace(rawUrl) == "" {
+		return "URL is empty"
+	}
+	if strings.IndexFunc(rawUrl, unicode.IsSpace) >= 0 {
+		return "URL contains white space"
+	}
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return err.Error()
+	}
+	if u.Scheme == "" {
+		return "URL has no scheme"
+	}
+	if (strings.EqualFold(u.Scheme, "http") || strings.EqualFold(u.Scheme, "https")) && u.Host == "" {
+		return "URL has no host"
+	}
+	return ""
+}
+
+// validateUrls reports a warning for every bookmark with malformed URL and
+// returns their number.
+func validateUrls(b *bookmarks, bookmarksFile string) int {
+	n := 0
+	walkBookmarks(b, func(e *bookmarksEntry, depth int) {
+		if !isUrlEntry(e) {
+			return
+		}
+		if p := urlProblem(e.Url); p != "" {
+			reportWarning(fmt.Sprintf("bookmarks file %s: bookmark %q has malformed URL %q: %s", bookmarksFile, e.Name, e.Url, p))
+			n++
+		}
+	})
+	return n
+}
+
+// walkBookmarks calls fn for every entry of the given bookmarks, in document
+// order. Roots are visited with depth 0.
+func walkBookmarks(b *bookmarks, fn func(e *bookmarksEntry, depth int)) {
+	for _, r := range rootEntries(b) {
+		walkEntry(r, 0, fn)
+	}
+}
+
+func walkEntry(e *bookmarksEntry, depth int, fn func(e *bookmarksEntry, depth int)) {
+	fn(e, depth)
+	for _, c := range e.Children {
+		if c != nil {
+			walkEntry(c, depth+1, fn)
+		}
+	}
+}
+
+// shortHash returns first 8 hex characters of SHA-256 of the given string.
+func shortHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:4])
+}
+
+// redactBookmarks replaces URLs (and optionally names, except for roots) with
+// their short hashes, keeping the structure of bookmarks intact.
+func redactBookmarks(b *bookmarks, urls, names bool) {
+	walkBookmarks(b, func(e *bookmarksEntry, depth int) {
+		if urls && e.Url != "" {
+			e.Url = shortHash(e.Url)
+		}
+		if names && depth > 0 && e.Name != "" {
+			e.Name = shortHash(e.Name)
+		}
+	})
+}
+
+// indexEntries records position of every entry among its siblings, so that
+// the original order can be shown after sorting.
+func indexEntries(b *bookmarks) {
+	walkBookmarks(b, func(e *bookmarksEntry, depth int) {
+		for i, c := range e.Children {
+			c.index = i + 1
+		}
+	})
+}
+
+// limitNesting removes children of folders nested deeper than limit levels
+// below roots and reports an error for every removed subtree. Folders
+// containing one of their own ancestors (circular references) or null entries
+// have such children removed and reported as well. It protects all further
+// (recursive) processing from extremely deep or endless trees.
+func limitNesting(b *bookmarks, limit int, bookmarksFile string) {
+	ancestors := map[*bookmarksEntry]bool{}
+	var limitEntry func(e *bookmarksEntry, depth int)
+	limitEntry = func(e *bookmarksEntry, depth int) {
+		if depth >= limit && len(e.Children) != 0 {
+			reportError(fmt.Errorf("bookmarks file %s: folder %q is nested deeper than %d levels, its content has been skipped", bookmarksFile, e.Name, limit))
+			e.Children = nil
+			return
+		}
+		ancestors[e] = true
+		defer delete(ancestors, e)
+		children := e.Children[:0]
+		for _, c := range e.Children {
+			if c == nil {
+				reportError(fmt.Errorf("bookmarks file %s: folder %q contains null entry, it has been skipped", bookmarksFile, e.Name))
+				continue
+			}
+			if ancestors[c] {
+				reportError(fmt.Errorf("bookmarks file %s: folder %q contains circular reference to %q, the reference has been skipped", bookmarksFile, e.Name, c.Name))
+				continue
+			}
+			limitEntry(c, depth+1)
+			children = append(children, c)
+		}
+		e.Children = children
+	}
+	for _, r := range rootEntries(b) {
+		limitEntry(r, 0)
+	}
+}
+
+// parseDays parses duration like time.ParseDuration, additionally accepting
+// d (days) and w (weeks) units, like 30d or 2w.
+func parseDays(s string) (time.Duration, error) {
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	for u, d := range units {
+		if n, err := strconv.ParseFloat(strings.TrimSuffix(s, u), 64); strings.HasSuffix(s, u) && err == nil && n >= 0 {
+			return time.Duration(n * float64(d)), nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q, expected number followed by unit, like 30d, 2w or 12h", s)
+	}
+	return d, nil
+}
+
+// isStale reports whether bookmark was not used since the given time. Never
+// used bookmarks are stale.
+func isStale(e *bookmarksEntry, since time.Time) bool {
+	t, ok := chromeTimeToTime(e.DateLastUsed)
+	return !ok || t.Before(since)
+}
+
+// rewriteUrls replaces URL of every bookmark of b with the result of fn.
+func rewriteUrls(b *bookmarks, fn func(rawUrl string) string) {
+	walkBookmarks(b, func(e *bookmarksEntry, depth int) {
+		if e.Url != "" {
+			e.Url = fn(e.Url)
+		}
+	})
+}
+
+// normalizeHost returns URL with lowercased scheme and host. Remaining parts of
+// URL are left intact. URLs that cannot be parsed are returned unchanged.
+func normalizeHost(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.Host == "" {
+		return rawUrl
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	return u.String()
+}
+
+// emojiRunes covers emoji and pictographic symbols, together with runes only
+// used to compose them (joiners, variation selectors, keycaps and tags).
+var emojiRunes = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x200d, 0x200d, 1}, // zero width joiner
+		{0x20e3, 0x20e3, 1}, // combining enclosing keycap
+		{0x2300, 0x23ff, 1}, // miscellaneous technical
+		{0x2600, 0x27bf, 1}, // miscellaneous symbols and dingbats
+		{0x2b00, 0x2bff, 1}, // miscellaneous symbols and arrows
+		{0xfe0e, 0xfe0f, 1}, // variation selectors
+	},
+	R32: []unicode.Range32{
+		{0x1f000, 0x1faff, 1}, // mahjong tiles up to symbols and pictographs extended-a
+		{0xe0020, 0xe007f, 1}, // tags
+	},
+}
+
+// stripEmoji removes emoji from the given name. Spaces left doubled, leading
+// or trailing by the removal are dropped as well, other spaces are kept.
+func stripEmoji(name string) string {
+	sb, stripped := &strings.Builder{}, false
+	for _, r := range name {
+		if unicode.Is(emojiRunes, r) {
+			stripped = true
+			continue
+		}
+		if r == ' ' && stripped && (sb.Len() == 0 || strings.HasSuffix(sb.String(), " ")) {
+			continue
+		}
+		sb.WriteRune(r)
+		stripped = false
+	}
+	if stripped {
+		return strings.TrimRight(sb.String(), " ")
+	}
+	return sb.String()
+}
+
+// nameReplacer returns function applying replacements given as comma separated
+// list of old=new pairs to names, in order. With useRegex set, old parts are
+// regular expressions and new parts may refer to their groups, like $1.
+// Returns nil for empty list.
+func nameReplacer(pairs string, useRegex bool) (func(string) string, error) {
+	replacements := []func(string) string(nil)
+	for _, pair := range strings.Split(pairs, ",") {
+		if pair == "" {
+			continue
+		}
+		i := strings.Index(pair, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid name replacement %q, expected old=new", pair)
+		}
+		old, repl := pair[:i], pair[i+1:]
+		if !useRegex {
+			replacements = append(replacements, func(s string) string { return strings.ReplaceAll(s, old, repl) })
+			continue
+		}
+		re, err := regexp.Compile(old)
+		if err != nil {
+			return nil, fmt.Errorf("invalid name replacement pattern %q: %w", old, err)
+		}
+		replacements = append(replacements, func(s string) string { return re.ReplaceAllString(s, repl) })
+	}
+	if replacements == nil {
+		return nil, nil
+	}
+	return func(s string) string {
+		for _, r := range replacements {
+			s = r(s)
+		}
+		return s
+	}, nil
+}
+
+var nameCases = []string{"none", "lower", "upper", "title"}
+
+// nameCaser returns function changing case of names to the given one, or nil
+// when names should be left intact.
+func nameCaser(nameCase string) (func(string) string, error) {
+	switch nameCase {
+	case "none", "":
+		return nil, nil
+	case "lower":
+		return strings.ToLower, nil
+	case "upper":
+		return strings.ToUpper, nil
+	case "title":
+		return titleCase, nil
+	default:
+		return nil, fmt.Errorf("unknown name case %q, expected one of: %s", nameCase, strings.Join(nameCases, ", "))
+	}
+}
+
+// titleCase upper cases the first letter of every word and lower cases the
+// remaining ones. Words are sequences of letters, digits and apostrophes.
+func titleCase(s string) string {
+	sb, inWord := strings.Builder{}, false
+	for _, r := range s {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || (inWord && (r == '\'' || r == '’')):
+			if inWord {
+				sb.WriteRune(unicode.ToLower(r))
+			} else {
+				sb.WriteRune(unicode.ToTitle(r))
+			}
+			inWord = true
+		default:
+			sb.WriteRune(r)
+			inWord = false
+		}
+	}
+	return sb.String()
+}
+
+// stripUrlParts returns URL without fragment and/or query string. URLs that
+// cannot be parsed are returned unchanged.
+func stripUrlParts(rawUrl string, fragment, query bool) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl
+	}
+	if fragment {
+		u.Fragment, u.RawFragment = "", ""
+	}
+	if query {
+		u.RawQuery, u.ForceQuery = "", false
+	}
+	return u.String()
+}
+
+// flattenBookmarks returns new flat bookmarks, that list all bookmarks of b
+// without folders. Each bookmark gets path of its folders (excluding roots),
+// preceded by the given prefix, as a breadcrumb.
+func flattenBookmarks(b *bookmarks, prefix []string) *bookmarks {
+	all := &bookmarksEntry{Type: "folder"}
+	var collect func(entries []*bookmarksEntry, path []string)
+	collect = func(entries []*bookmarksEntry, path []string) {
+		for _, e := range entries {
+			if isUrlEntry(e) {
+				e.breadcrumb = append([]string(nil), path...)
+				all.Children = append(all.Children, e)
+			} else {
+				collect(e.Children, append(path[:len(path):len(path)], e.Name))
+			}
+		}
+	}
+	for _, r := range rootEntries(b) {
+		collect(r.Children, prefix)
+	}
+	return &bookmarks{Version: b.Version, Roots: map[string]*bookmarksEntry{"flat": all}, flat: true}
+}
+
+// combineRoots returns new flat bookmarks, that list children of all roots of b
+// one after another, keeping folders. When mergeFolders is set, folders of the
+// same name are merged into one (like with --merge-profiles).
+func combineRoots(b *bookmarks, mergeFolders bool, profileName string) *bookmarks {
+	all := &bookmarksEntry{Type: "folder"}
+	for _, r := range rootEntries(b) {
+		if mergeFolders {
+			mergeFolder(all, r, profileName)
+		} else {
+			all.Children = append(all.Children, r.Children...)
+		}
+	}
+	all.mergedFrom = nil
+	return &bookmarks{Version: b.Version, Roots: map[string]*bookmarksEntry{"combined": all}, flat: true}
+}
+
+// recentBookmarks returns new flat bookmarks (like flattenBookmarks) with only
+// n most recently added bookmarks of b, newest first. Bookmarks without date
+// go last.
+func recentBookmarks(b *bookmarks, n int, prefix []string) *bookmarks {
+	res := flattenBookmarks(b, prefix)
+	all := res.Roots["flat"]
+	sort.SliceStable(all.Children, func(i, j int) bool {
+		ti, oki := chromeTimeToTime(all.Children[i].DateAdded)
+		tj, okj := chromeTimeToTime(all.Children[j].DateAdded)
+		if oki != okj {
+			return oki
+		}
+		return ti.After(tj)
+	})
+	if len(all.Children) > n {
+		all.Children = all.Children[:n]
+	}
+	return res
+}
+
+// capChildren leaves at most n children in every folder, recording the number
+// of removed ones in the folder, to be summarized by markdown and tree output.
+func capChildren(b *bookmarks, n int) {
+	walkBookmarks(b, func(e *bookmarksEntry, depth int) {
+		if len(e.Children) > n {
+			e.omitted += len(e.Children) - n
+			e.Children = e.Children[:n:n]
+		}
+	})
+}
+
+// omittedLine returns line summarizing the given number of entries removed by
+// capChildren.
+func omittedLine(n int) string {
+	return fmt.Sprintf("… and %d more", n)
+}
+
+// groupBookmarks returns new bookmarks with all bookmarks of b (ignoring
+// folders) grouped into sections named by key. Sections are ordered with less
+// and bookmarks within a section keep the document order.
+func groupBookmarks(b *bookmarks, key func(e *bookmarksEntry) string, less func(a, b string) bool) *bookmarks {
+	res := &bookmarks{Version: b.Version, Roots: map[string]*bookmarksEntry{}, sections: true}
+	walkBookmarks(b, func(e *bookmarksEntry, depth int) {
+		if depth == 0 || !isUrlEntry(e) {
+			return
+		}
+		k := key(e)
+		g, ok := res.Roots[k]
+		if !ok {
+			g = &bookmarksEntry{Name: k, Type: "folder"}
+			res.Roots[k] = g
+			res.order = append(res.order, k)
+		}
+		g.Children = append(g.Children, e)
+	})
+	sort.SliceStable(res.order, func(i, j int) bool { return less(res.order[i], res.order[j]) })
+	return res
+}
+
+// alphaIndexKey returns upper-cased first letter of the entry name or "#" for
+// names starting with anything else.
+func alphaIndexKey(e *bookmarksEntry) string {
+	for _, r := range e.Name {
+		if unicode.IsLetter(r) {
+			return string(unicode.ToUpper(r))
+		}
+		break
+	}
+	return "#"
+}
+
+// alphaIndex groups bookmarks by the first letter of their names. Letters are
+// sorted alphabetically, with the group for non-letters last.
+func alphaIndex(b *bookmarks) *bookmarks {
+	res := groupBookmarks(b, alphaIndexKey, func(a, b string) bool {
+		if a == "#" || b == "#" {
+			return b == "#" && a != "#"
+		}
+		return a < b
+	})
+	for _, g := range res.Roots {
+		sort.SliceStable(g.Children, func(i, j int) bool {
+			return strings.ToLower(g.Children[i].Name) < strings.ToLower(g.Children[j].Name)
+		})
+	}
+	return res
+}
+
+var groupByKeys = []string{"none", "domain", "tld", "tag", "date"}
+
+var dateBuckets = map[string]string{"day": "2006-01-02", "month": "2006-01", "year": "2006"}
+
+// groupByDate returns new bookmarks with all bookmarks of b grouped into
+// sections by the day, month or year they were added. Sections are sorted
+// chronologically, bookmarks without date go to the last "Undated" section.
+func groupByDate(b *bookmarks, bucket string) (*bookmarks, error) {
+	layout, ok := dateBuckets[bucket]
+	if !ok {
+		return nil, fmt.Errorf("unknown date bucket %q, expected one of: day, month, year", bucket)
+	}
+	const undated = "Undated"
+	return groupBookmarks(b, func(e *bookmarksEntry) string {
+		t, ok := chromeTimeToTime(e.DateAdded)
+		if !ok {
+			return undated
+		}
+		return t.Format(layout)
+	}, func(a, b string) bool {
+		if a == undated || b == undated {
+			return b == undated && a != undated
+		}
+		return a < b // layouts order lexicographically in chronological order
+	}), nil
+}
+
+// entryTags returns tags of the entry, stored as comma separated list under the
+// given meta info key.
+func entryTags(e *bookmarksEntry, key string) []string {
+	res := []string(nil)
+	for _, t := range strings.Split(e.MetaInfo[key], ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+// groupByTag returns new bookmarks with all bookmarks of b grouped into
+// sections by their tags, stored under the given meta info key. Bookmarks with
+// many tags are listed in each of their sections, bookmarks without tags go to
+// the last "Untagged" section. Sections are sorted by name.
+func groupByTag(b *bookmarks, key string) *bookmarks {
+	const untagged = "Untagged"
+	res := &bookmarks{Version: b.Version, Roots: map[string]*bookmarksEntry{}, sections: true}
+	add := func(tag string, e *bookmarksEntry) {
+		g, ok := res.Roots[tag]
+		if !ok {
+			g = &bookmarksEntry{Name: tag, Type: "folder"}
+			res.Roots[tag] = g
+			res.order = append(res.order, tag)
+		}
+		g.Children = append(g.Children, e)
+	}
+	walkBookmarks(b, func(e *bookmarksEntry, depth int) {
+		if depth == 0 || !isUrlEntry(e) {
+			return
+		}
+		tags := entryTags(e, key)
+		if len(tags) == 0 {
+			add(untagged, e)
+		}
+		for _, t := range tags {
+			add(t, e)
+		}
+	})
+	sort.SliceStable(res.order, func(i, j int) bool {
+		a, b := res.order[i], res.order[j]
+		if a == untagged || b == untagged {
+			return b == untagged && a != untagged
+		}
+		return a < b
+	})
+	return res
+}
+
+// publicSuffixes is a subset of the Public Suffix List
+// (https://publicsuffix.org/), listing the most common suffixes spanning more
+// than one label: second level suffixes of country code domains and hosting
+// domains under which every subdomain belongs to a different owner. Single
+// label suffixes (top level domains) are not listed, every last label is one.
+var publicSuffixes = map[string]bool{
+	// country code second level domains
+	"ac.uk": true, "co.uk": true, "gov.uk": true, "ltd.uk": true, "me.uk": true, "net.uk": true, "org.uk": true, "plc.uk": true, "sch.uk": true,
+	"com.au": true, "edu.au": true, "gov.au": true, "net.au": true, "org.au": true, "id.au": true,
+	"co.nz": true, "net.nz": true, "org.nz": true, "govt.nz": true, "ac.nz": true,
+	"ac.jp": true, "co.jp": true, "go.jp": true, "ne.jp": true, "or.jp": true,
+	"ac.kr": true, "co.kr": true, "go.kr": true, "or.kr": true, "ne.kr": true,
+	"com.br": true, "net.br": true, "org.br": true, "gov.br": true,
+	"com.cn": true, "net.cn": true, "org.cn": true, "edu.cn": true, "gov.cn": true,
+	"com.hk": true, "com.tw": true, "com.sg": true, "com.my": true, "com.ph": true, "com.vn": true,
+	"co.in": true, "net.in": true, "org.in": true, "ac.in": true, "gov.in": true,
+	"co.id": true, "co.il": true, "co.th": true, "co.za": true, "org.za": true,
+	"com.ar": true, "com.mx": true, "com.tr": true, "com.ua": true, "com.pl": true, "net.pl": true, "org.pl": true,
+	// hosting domains
+	"appspot.com": true, "azurewebsites.net": true, "blogspot.com": true, "cloudfront.net": true, "firebaseapp.com": true,
+	"github.io": true, "gitlab.io": true, "herokuapp.com": true, "myshopify.com": true, "netlify.app": true,
+	"pages.dev": true, "s3.amazonaws.com": true, "vercel.app": true, "web.app": true,
+}
+
+// registeredDomain returns domain registered under a public suffix, so that
+// subdomains (like gist.github.com) are consolidated with their parent domain
+// (github.com). The longest suffix of the host listed in publicSuffixes is
+// used, or the last label when none is listed, and the domain is the suffix
+// with one more label in front. Hosts under suffixes missing from the list
+// (like kawasaki.jp) are thus reduced to their last two labels. IP addresses,
+// single label hosts and public suffixes themselves are returned unchanged.
+func registeredDomain(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	labels := strings.Split(host, ".")
+	n := 2 // labels of the registered domain
+	for i := 0; i < len(labels)-1; i++ {
+		if publicSuffixes[strings.Join(labels[i:], ".")] {
+			n = len(labels) - i + 1
+			break
+		}
+	}
+	if len(labels) <= n {
+		return host
+	}
+	return strings.Join(labels[len(labels)-n:], ".")
+}
+
+// groupByHost returns new bookmarks with all bookmarks of b grouped into
+// sections by their host (domain) or registered domain (tld). Sections are
+// sorted by name, bookmarks without host go to the last "(no host)" section.
+// With stripWww set, leading "www." is removed from hosts.
+func groupByHost(b *bookmarks, by string, stripWww bool) (*bookmarks, error) {
+	if by != "domain" && by != "tld" {
+		return nil, fmt.Errorf("unknown grouping %q, expected one of: %s", by, strings.Join(groupByKeys, ", "))
+	}
+	const noHost = "(no host)"
+	return groupBookmarks(b, func(e *bookmarksEntry) string {
+		h := strings.ToLower(urlHost(e.Url))
+		if h == "" {
+			return noHost
+		}
+		if stripWww && strings.HasPrefix(h, "www.") && len(h) > 4 {
+			h = h[4:]
+		}
+		if by == "tld" {
+			return registeredDomain(h)
+		}
+		return h
+	}, func(a, b string) bool {
+		if a == noHost || b == noHost {
+			return b == noHost && a != noHost
+		}
+		return a < b
+	}), nil
+}
+
+// pruneBookmarks removes all entries (together with their subtrees) for which
+// remove returns true.
+func pruneBookmarks(b *bookmarks, remove func(*bookmarksEntry) bool) {
+	for k, r := range b.Roots {
+		if r == nil {
+			continue
+		}
+		if remove(r) {
+			delete(b.Roots, k)
+			continue
+		}
+		r.Children = pruneEntries(r.Children, remove)
+	}
+}
+
+func pruneEntries(entries []*bookmarksEntry, remove func(*bookmarksEntry) bool) []*bookmarksEntry {
+	res := []*bookmarksEntry(nil)
+	for _, e := range entries {
+		if remove(e) {
+			continue
+		}
+		e.Children = pruneEntries(e.Children, remove)
+		res = append(res, e)
+	}
+	return res
+}
+
+// hasBookmarks reports whether there is any bookmark within the given folder,
+// at any depth.
+func hasBookmarks(e *bookmarksEntry) bool {
+	for _, c := range e.Children {
+		if isUrlEntry(c) || hasBookmarks(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneEmptyFolders removes folders (other than roots) that do not contain any
+// bookmarks, at any depth.
+func pruneEmptyFolders(b *bookmarks) {
+	for _, r := range rootEntries(b) {
+		r.Children = pruneEntries(r.Children, func(e *bookmarksEntry) bool {
+			return !isUrlEntry(e) && !hasBookmarks(e)
+		})
+	}
+}
+
+var sortOrders = []string{"none", "name", "date"}
+
+var sortTiebreaks = []string{"none", "name", "url"}
+
+// withTiebreak returns comparator ordering entries with less, and entries equal
+// according to less by name or URL, as requested by tiebreak.
+func withTiebreak(less func(a, b *bookmarksEntry) bool, tiebreak string, caseSensitive bool) (func(a, b *bookmarksEntry) bool, error) {
+	var tie func(a, b *bookmarksEntry) bool
+	switch tiebreak {
+	case "none", "":
+		return less, nil
+	case "name":
+		tie, _ = entriesComparator("name", caseSensitive)
+	case "url":
+		tie = func(a, b *bookmarksEntry) bool { return a.Url < b.Url }
+	default:
+		return nil, fmt.Errorf("unknown sort tiebreak %q, expected one of: %s", tiebreak, strings.Join(sortTiebreaks, ", "))
+	}
+	if less == nil {
+		return nil, nil
+	}
+	return func(a, b *bookmarksEntry) bool {
+		if less(a, b) {
+			return true
+		}
+		return !less(b, a) && tie(a, b)
+	}, nil
+}
+
+// entriesComparator returns less function for the given sort order or nil when
+// entries should be kept in the original order. Names are compared ignoring
+// case, unless caseSensitive is set (then "Zebra" goes before "apple").
+func entriesComparator(order string, caseSensitive bool) (func(a, b *bookmarksEntry) bool, error) {
+	switch order {
+	case "none", "":
+		return nil, nil
+	case "name":
+		if caseSensitive {
+			return func(a, b *bookmarksEntry) bool { return a.Name < b.Name }, nil
+		}
+		return func(a, b *bookmarksEntry) bool {
+			return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+		}, nil
+	case "date":
+		return func(a, b *bookmarksEntry) bool {
+			ta, oka := chromeTimeToTime(a.DateAdded)
+			tb, okb := chromeTimeToTime(b.DateAdded)
+			if oka != okb {
+				return oka // entries without date go last
+			}
+			return ta.Before(tb)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown sort order %q, expected one of: %s", order, strings.Join(sortOrders, ", "))
+	}
+}
+
+// sortBookmarks sorts children of every folder. Bookmarks and folders are
+// sorted independently with their own comparators and each group keeps the
+// positions it occupied in the original order. Nil comparator leaves the
+// group untouched.
+func sortBookmarks(b *bookmarks, urlsLess, foldersLess func(a, b *bookmarksEntry) bool) {
+	for _, r := range b.Roots {
+		if r != nil {
+			sortEntries(r.Children, urlsLess, foldersLess)
+		}
+	}
+}
+
+func sortEntries(entries []*bookmarksEntry, urlsLess, foldersLess func(a, b *bookmarksEntry) bool) {
+	urls, folders := []*bookmarksEntry(nil), []*bookmarksEntry(nil)
+	for _, e := range entries {
+		if isUrlEntry(e) {
+			urls = append(urls, e)
+		} else {
+			folders = append(folders, e)
+			sortEntries(e.Children, urlsLess, foldersLess)
+		}
+	}
+	if urlsLess != nil {
+		sort.SliceStable(urls, func(i, j int) bool { return urlsLess(urls[i], urls[j]) })
+	}
+	if foldersLess != nil {
+		sort.SliceStable(folders, func(i, j int) bool { return foldersLess(folders[i], folders[j]) })
+	}
+	for i, e := range entries {
+		if isUrlEntry(e) {
+			entries[i], urls = urls[0], urls[1:]
+		} else {
+			entries[i], folders = folders[0], folders[1:]
+		}
+	}
+}
+
+// mergeProfiles merges all the given profiles into one. Roots and folders with
+// the same path are merged together, while bookmarks are kept as they are.
+func mergeProfiles(profiles []*profile) *profile {
+	names, origins := []string(nil), []string(nil)
+	res := &bookmarks{Version: 1, Roots: map[string]*bookmarksEntry{}}
+	for _, p := range profiles {
+		names = append(names, p.name)
+		origins = append(origins, p.source.origin)
+		for _, k := range rootKeys(p.bookmarks) {
+			r := p.bookmarks.Roots[k]
+			if res.Roots[k] == nil {
+				res.Roots[k] = emptyFolderCopy(r)
+			}
+			mergeFolder(res.Roots[k], r, p.name)
+		}
+	}
+	name := strings.Join(names, ", ")
+	return &profile{
+		name:      name,
+		source:    bookmarksSource{profile: name, path: strings.Join(origins, ", "), origin: strings.Join(origins, ", ")},
+		bookmarks: res,
+	}
+}
+
+func emptyFolderCopy(e *bookmarksEntry) *bookmarksEntry {
+	c := *e
+	c.Children = nil
+	c.mergedFrom = nil
+	return &c
+}
+
+func mergeFolder(dst, src *bookmarksEntry, profileName string) {
+	if n := len(dst.mergedFrom); n == 0 || dst.mergedFrom[n-1] != profileName {
+		dst.mergedFrom = append(dst.mergedFrom, profileName)
+	}
+	for _, c := range src.Children {
+		if isUrlEntry(c) {
+			dst.Children = append(dst.Children, c)
+			continue
+		}
+		target := (*bookmarksEntry)(nil)
+		for _, d := range dst.Children {
+			if !isUrlEntry(d) && d.Name == c.Name {
+				target = d
+				break
+			}
+		}
+		if target == nil {
+			target = emptyFolderCopy(c)
+			dst.Children = append(dst.Children, target)
+		}
+		mergeFolder(target, c, profileName)
+	}
+}
+
+var dedupeStrategies = []string{"first", "last", "shallowest", "deepest", "shortest"}
+
+var dedupeKeys = []string{"url", "title"}
+
+// dedupeKey returns function returning key identifying duplicated bookmarks.
+// With stripWww set, leading "www." of the host is ignored.
+func dedupeKey(stripWww bool) func(e *bookmarksEntry) string {
+	return func(e *bookmarksEntry) string {
+		u := strings.TrimSpace(e.Url)
+		if stripWww {
+			u = stripWwwHost(u)
+		}
+		return u
+	}
+}
+
+// shortestDedupeKey returns function returning key identifying bookmarks by
+// their URLs without query string, fragment and trailing slash, so that the
+// shortest strategy has variants of the same page to choose from.
+func shortestDedupeKey(stripWww bool) func(e *bookmarksEntry) string {
+	key := dedupeKey(stripWww)
+	return func(e *bookmarksEntry) string {
+		return strings.TrimSuffix(stripUrlParts(key(e), true, true), "/")
+	}
+}
+
+// stripWwwHost removes leading "www." from the host of the given URL, leaving
+// not parsable URLs unchanged.
+func stripWwwHost(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil || len(u.Host) <= 4 || !strings.EqualFold(u.Host[:4], "www.") {
+		return rawUrl
+	}
+	u.Host = u.Host[4:]
+	return u.String()
+}
+
+// dedupeTitleKey returns key identifying bookmarks with the same case-folded
+// name.
+func dedupeTitleKey(e *bookmarksEntry) string {
+	return strings.ToLower(strings.TrimSpace(e.Name))
+}
+
+// dedupeBookmarks removes bookmarks with duplicated URLs (or names, when by
+// is title), keeping a single occurrence chosen by the given strategy: first
+// or last in document order, or the one nested in the least (shallowest) or
+// most (deepest) folders, or the one with the shortest raw URL (shortest,
+// preferring URLs without tracking parameters). With the shortest strategy
+// URLs differing only in query string, fragment or trailing slash are
+// duplicates. Ties are resolved in favour of the first occurrence. With
+// stripWww set, URLs differing only in leading "www." of the host are
+// duplicates.
+func dedupeBookmarks(b *bookmarks, strategy, by string, stripWww bool) error {
+	type occurrence struct {
+		entry *bookmarksEntry
+		depth int
+	}
+	better := map[string]func(o, kept occurrence) bool{
+		"first":      func(o, kept occurrence) bool { return false },
+		"last":       func(o, kept occurrence) bool { return true },
+		"shallowest": func(o, kept occurrence) bool { return o.depth < kept.depth },
+		"deepest":    func(o, kept occurrence) bool { return o.depth > kept.depth },
+		"shortest":   func(o, kept occurrence) bool { return len(o.entry.Url) < len(kept.entry.Url) },
+	}[strategy]
+	if better == nil {
+		return fmt.Errorf("unknown dedupe strategy %q, expected one of: %s", strategy, strings.Join(dedupeStrategies, ", "))
+	}
+	key := map[string]func(e *bookmarksEntry) string{"url": dedupeKey(stripWww), "title": dedupeTitleKey}[by]
+	if key == nil {
+		return fmt.Errorf("unknown dedupe key %q, expected one of: %s", by, strings.Join(dedupeKeys, ", "))
+	}
+	if strategy == "shortest" && by == "url" {
+		key = shortestDedupeKey(stripWww)
+	}
+
+	kept := map[string]occurrence{}
+	walkBookmarks(b, func(e *bookmarksEntry, depth int) {
+		if depth == 0 || !isUrlEntry(e) {
+			return
+		}
+		k, o := key(e), occurrence{e, depth}
+		if prev, ok := kept[k]; !ok || better(o, prev) {
+			kept[k] = o
+		}
+	})
+	pruneBookmarks(b, func(e *bookmarksEntry) bool {
+		return isUrlEntry(e) && kept[key(e)].entry != e
+	})
+	return nil
+}
+
+// duplicateGroup lists all occurrences of bookmarks sharing the same URL.
+type duplicateGroup struct {
+	Url         string                `json:"url"`
+	Occurrences []duplicateOccurrence `json:"occurrences"`
+}
+
+type duplicateOccurrence struct {
+	Profile string   `json:"profile"`
+	Path    []string `json:"path"`
+	Name    string   `json:"name"`
+}
+
+// findDuplicates returns groups of bookmarks sharing the same dedupe key,
+// across all the given profiles. Groups are ordered by their first occurrence.
+func findDuplicates(profiles []*profile, stripWww bool) []*duplicateGroup {
+	key := dedupeKey(stripWww)
+	groups := map[string]*duplicateGroup{}
+	order := []string(nil)
+	for _, p := range profiles {
+		var collect func(entries []*bookmarksEntry, path []string)
+		collect = func(entries []*bookmarksEntry, path []string) {
+			for _, e := range entries {
+				if !isUrlEntry(e) {
+					collect(e.Children, append(path[:len(path):len(path)], e.Name))
+					continue
+				}
+				k := key(e)
+				g, ok := groups[k]
+				if !ok {
+					g = &duplicateGroup{Url: strings.TrimSpace(e.Url)}
+					groups[k] = g
+					order = append(order, k)
+				}
+				g.Occurrences = append(g.Occurrences, duplicateOccurrence{Profile: p.name, Path: path, Name: e.Name})
+			}
+		}
+		for _, r := range rootEntries(p.bookmarks) {
+			collect(r.Children, []string{r.Name})
+		}
+	}
+
+	res := []*duplicateGroup(nil)
+	for _, k := range order {
+		if len(groups[k].Occurrences) > 1 {
+			res = append(res, groups[k])
+		}
+	}
+	return res
+}
+
+// crossProfileDuplicates returns groups with bookmarks from at least two
+// different profiles.
+func crossProfileDuplicates(groups []*duplicateGroup) []*duplicateGroup {
+	res := []*duplicateGroup(nil)
+	for _, g := range groups {
+		profiles := map[string]bool{}
+		for _, o := range g.Occurrences {
+			profiles[o.Profile] = true
+		}
+		if len(profiles) > 1 {
+			res = append(res, g)
+		}
+	}
+	return res
+}
+
+// writeDedupeReport writes groups of duplicated bookmarks as Markdown or JSON
+// document with the given title.
+func writeDedupeReport(w io.Writer, title string, groups []*duplicateGroup, format string) error {
+	if format == "json" {
+		if groups == nil {
+			groups = []*duplicateGroup{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(groups)
+	}
+
+	if err := writef(w, "# %s\n\n", title); err != nil {
+		return err
+	}
+	if len(groups) == 0 {
+		return writef(w, "No duplicated bookmarks found.\n")
+	}
+	for _, g := range groups {
+		if err := writef(w, "## %s\n\n", g.Url); err != nil {
+			return err
+		}
+		for _, o := range g.Occurrences {
+			if err := writef(w, "- Profile %s: %s / %s\n", o.Profile, strings.Join(o.Path, " / "), o.Name); err != nil {
+				return err
+			}
+		}
+		if err := writef(w, "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// domainCount is the number of bookmarks pointing at a single domain.
+type domainCount struct {
+	Domain string
+	Count  int
+}
+
+// domainStats returns numbers of bookmarks of all the given profiles per
+// domain, sorted by count (most bookmarked domains first) and then by domain.
+// Bookmarks without host (or with not parsable URLs) are counted under
+// "(no host)". With stripWww set, leading "www." is removed from hosts.
+func domainStats(profiles []*profile, stripWww bool) []domainCount {
+	const noHost = "(no host)"
+	counts := map[string]int{}
+	for _, p := range profiles {
+		walkBookmarks(p.bookmarks, func(e *bookmarksEntry, depth int) {
+			if !isUrlEntry(e) {
+				return
+			}
+			h := strings.ToLower(urlHost(e.Url))
+			if h == "" {
+				h = noHost
+			} else if stripWww && strings.HasPrefix(h, "www.") && len(h) > 4 {
+				h = h[4:]
+			}
+			counts[h]++
+		})
+	}
+	res := make([]domainCount, 0, len(counts))
+	for d, c := range counts {
+		res = append(res, domainCount{d, c})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Count != res[j].Count {
+			return res[i].Count > res[j].Count
+		}
+		return res[i].Domain < res[j].Domain
+	})
+	return res
+}
+
+// writeDomainStats writes table of domains and their bookmark counts, as
+// markdown or csv.
+func writeDomainStats(w io.Writer, stats []domainCount, format string) error {
+	if format == "csv" {
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"domain", "bookmarks"}); err != nil {
+			return err
+		}
+		for _, s := range stats {
+			if err := cw.Write([]string{s.Domain, strconv.Itoa(s.Count)}); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+
+	if err := writef(w, "# Bookmarks by domain\n\n"); err != nil {
+		return err
+	}
+	if len(stats) == 0 {
+		return writef(w, "No bookmarks found.\n")
+	}
+	if err := writef(w, "| Domain | Bookmarks |\n|--------|-----------|\n"); err != nil {
+		return err
+	}
+	for _, s := range stats {
+		if err := writef(w, "| %s | %d |\n", s.Domain, s.Count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateBookmarks checks that bookmarks file content is a well-formed Chrome
+// bookmarks document and returns the list of found problems.
+// Content that cannot be parsed at all is reported as error with parse exit
+// code instead.
+func validateBookmarks(data []byte, bookmarksFile string) ([]string, error) {
+	b, err := parseBookmarks(data, bookmarksFile)
+	if err != nil {
+		return nil, &exitError{exitParse, fmt.Errorf("bookmarks file %s: %w", bookmarksFile, err)}
+	}
+
+	problems := []string(nil)
+	if b.Version != 1 && b.Version != 2 {
+		problems = append(problems, fmt.Sprintf("unknown version %d", b.Version))
+	}
+	if b.Roots == nil {
+		return append(problems, "missing roots"), nil
+	}
+	for _, k := range rootsOrder {
+		if b.Roots[k] == nil {
+			problems = append(problems, fmt.Sprintf("missing root %q", k))
+		}
+	}
+	keys := make([]string, 0, len(b.Roots))
+	for k := range b.Roots {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if r := b.Roots[k]; r != nil {
+			problems = append(problems, validateEntry(r, k)...)
+		}
+	}
+	return problems, nil
+}
+
+func validateEntry(entry *bookmarksEntry, entryPath string) []string {
+	problems := []string(nil)
+	switch entry.Type {
+	case "url":
+		if entry.Url == "" {
+			problems = append(problems, fmt.Sprintf("%s: bookmark without url", entryPath))
+		}
+		if len(entry.Children) != 0 {
+			problems = append(problems, fmt.Sprintf("%s: bookmark with children", entryPath))
+		}
+	case "folder":
+	default:
+		problems = append(problems, fmt.Sprintf("%s: invalid entry type %q", entryPath, entry.Type))
+	}
+	for _, c := range entry.Children {
+		if c == nil {
+			problems = append(problems, fmt.Sprintf("%s: null entry", entryPath))
+			continue
+		}
+		problems = append(problems, validateEntry(c, joinFolderPath(entryPath, c.Name))...)
+	}
+	return problems
+}
+
+// warnDuplicates reports URL entries sharing a name with a sibling. Each
+// duplicated name is reported once per folder.
+func warnDuplicates(profileName string, folderPath string, entries []*bookmarksEntry) {
+	counts := map[string]int{}
+	names := []string(nil)
+	for _, e := range entries {
+		if !isUrlEntry(e) {
+			continue
+		}
+		if counts[e.Name] == 0 {
+			names = append(names, e.Name)
+		}
+		counts[e.Name]++
+	}
+	for _, n := range names {
+		if c := counts[n]; c > 1 {
+			reportWarning(fmt.Sprintf("profile %s: folder %s: %d bookmarks named %q", profileName, folderPath, c, n))
+		}
+	}
+
+	for _, e := range entries {
+		if !isUrlEntry(e) {
+			warnDuplicates(profileName, joinFolderPath(folderPath, e.Name), e.Children)
+		}
+	}
+}
+
+func joinFolderPath(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "/" + name
+}
+
+// formatter renders parsed bookmarks in a specific output format.
+type formatter interface {
+	writeHeader(w io.Writer) error
+	writeProfile(w io.Writer, p *profile) error
+	writeNote(w io.Writer, note string) error
+	writeSeparator(w io.Writer, separator string) error
+	writeFooter(w io.Writer) error
+}
+
+type outputFormat struct {
+	name          string
+	extension     string
+	makeFormatter func(cfg *config) formatter
+}
+
+var formats = []outputFormat{
+	{"markdown", ".md", func(cfg *config) formatter { return &markdownFormatter{cfg: cfg} }},
+	{"tree", ".txt", func(cfg *config) formatter { return &treeFormatter{cfg: cfg} }},
+	{"html", ".html", func(cfg *config) formatter { return &htmlFormatter{cfg: cfg} }},
+	{"confluence", ".xml", func(cfg *config) formatter { return &confluenceFormatter{htmlFormatter{cfg: cfg}} }},
+	{"rst", ".rst", func(cfg *config) formatter { return &rstFormatter{cfg: cfg} }},
+	{"asciidoc", ".adoc", func(cfg *config) formatter { return &asciidocFormatter{cfg: cfg} }},
+	{"org", ".org", func(cfg *config) formatter { return &orgFormatter{cfg: cfg} }},
+	{"dokuwiki", ".txt", func(cfg *config) formatter { return &dokuwikiFormatter{cfg: cfg} }},
+	{"urls", ".txt", func(cfg *config) formatter { return &urlsFormatter{cfg: cfg} }},
+	{"json-tree", ".json", func(cfg *config) formatter { return &jsonTreeFormatter{cfg: cfg} }},
+	{"jsonl", ".jsonl", func(cfg *config) formatter { return &jsonlFormatter{cfg: cfg} }},
+	{"sitemap", ".xml", func(cfg *config) formatter { return &sitemapFormatter{cfg: cfg} }},
+	{"template", ".txt", func(cfg *config) formatter { return &templateFormatter{cfg: cfg} }},
+}
+
+func formatNames() []string {
+	res := make([]string, 0, len(formats))
+	for _, f := range formats {
+		res = append(res, f.name)
+	}
+	return res
+}
+
+func findFormat(name string) (outputFormat, error) {
+	for _, f := range formats {
+		if f.name == name {
+			return f, nil
+		}
+	}
+	return outputFormat{}, fmt.Errorf("unknown output format %q, expected one of: %s", name, strings.Join(formatNames(), ", "))
+}
+
+// parseFormats parses comma separated list of output formats.
+func parseFormats(list string) ([]outputFormat, error) {
+	res := []outputFormat(nil)
+	for _, n := range strings.Split(list, ",") {
+		f, err := findFormat(strings.TrimSpace(n))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, f)
+	}
+	return res, nil
+}
+
+// outputTarget pairs formatter with the writer it renders to.
+type outputTarget struct {
+	f formatter
+	w WriteSyncCloser
+}
+
+// outputPaths returns output path for each of the requested formats. When more
+// than one format is requested, output path must be a file and every format is
+// written next to it with the extension swapped to the one of the format.
+func outputPaths(outFormats []outputFormat, path string) ([]string, error) {
+	if len(outFormats) == 1 {
+		return []string{path}, nil
+	}
+
+	if path == "" {
+		return nil, errors.New("multiple output formats require --output to be a file path")
+	}
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	seen := map[string]bool{}
+	res := []string(nil)
+	for _, f := range outFormats {
+		p := base + f.extension
+		if seen[p] {
+			return nil, fmt.Errorf("output path %s derived for format %s is used more than once", p, f.name)
+		}
+		seen[p] = true
+		res = append(res, p)
+	}
+	return res, nil
+}
+
+// makeOutputs creates output targets for all requested formats.
+func makeOutputs(outFormats []outputFormat, paths []string, cfg *config) ([]outputTarget, error) {
+	res := []outputTarget(nil)
+	for i, f := range outFormats {
+		w, err := makeOutput(paths[i], cfg.outputMode)
+		if err != nil {
+			return nil, err
+		}
+		if w, err = wrapOutput(w, cfg); err != nil {
+			return nil, err
+		}
+		res = append(res, outputTarget{f.makeFormatter(cfg), w})
+	}
+	return res, nil
+}
+
+// profile holds bookmarks loaded from a single source, ready for output.
+type profile struct {
+	name      string
+	source    bookmarksSource
+	bookmarks *bookmarks
+	folders   *bookmarks // folders overview built before capping, if any
+}
+
+// defaultEmptyPlaceholder is the default text written in place of empty
+// profiles, in Markdown.
+const defaultEmptyPlaceholder = "_No bookmarks._"
+
+// writeDocument writes complete document with all the given profiles. Non
+// empty note is written right after the document header. Profiles are
+// preceded by an overview of their folders when requested, and separated with
+// the configured separator. Placeholder is written in place of empty profiles
+// and in place of all profiles when there are none.
+func writeDocument(o outputTarget, profiles []*profile, note string, cfg *config) error {
+	if err := o.f.writeHeader(o.w); err != nil {
+		return err
+	}
+	if note != "" {
+		if err := o.f.writeNote(o.w, note); err != nil {
+			return err
+		}
+	}
+	if cfg.summaryTree {
+		if err := writeSummary(o, profiles); err != nil {
+			return err
+		}
+	}
+	placeholder := cfg.emptyPlaceholder
+	if _, ok := o.f.(*markdownFormatter); !ok && placeholder == defaultEmptyPlaceholder {
+		placeholder = "No bookmarks." // default uses Markdown emphasis
+	}
+	for i, p := range profiles {
+		if i > 0 && cfg.profileSeparator != "" {
+			if err := o.f.writeSeparator(o.w, cfg.profileSeparator); err != nil {
+				return err
+			}
+		}
+		if err := o.f.writeProfile(o.w, p); err != nil {
+			return err
+		}
+		if placeholder != "" && isEmptyProfile(p) {
+			if err := o.f.writeNote(o.w, placeholder); err != nil {
+				return err
+			}
+		}
+	}
+	if placeholder != "" && len(profiles) == 0 {
+		if err := o.f.writeNote(o.w, placeholder); err != nil {
+			return err
+		}
+	}
+	if err := o.f.writeFooter(o.w); err != nil {
+		return err
+	}
+	return o.w.Sync()
+}
+
+// writeSummary writes folders of the given profiles (like with --only-folders),
+// followed by a note starting the full listing. Folders overview saved in the
+// profile is used if present, so that the overview lists all folders even when
+// bookmarks are capped with --max-children.
+func writeSummary(o outputTarget, profiles []*profile) error {
+	if err := o.f.writeNote(o.w, "Folders overview"); err != nil {
+		return err
+	}
+	for _, p := range profiles {
+		if p.bookmarks.flat {
+			continue
+		}
+		b := p.folders
+		if b == nil {
+			b = folderTree(p.bookmarks)
+		}
+		folders := &profile{name: p.name, source: p.source, bookmarks: b}
+		if err := o.f.writeProfile(o.w, folders); err != nil {
+			return err
+		}
+	}
+	return o.f.writeNote(o.w, "All bookmarks")
+}
+
+// folderTree returns copy of b with folders only.
+func folderTree(b *bookmarks) *bookmarks {
+	var copyFolder func(e *bookmarksEntry) *bookmarksEntry
+	copyFolder = func(e *bookmarksEntry) *bookmarksEntry {
+		c := emptyFolderCopy(e)
+		c.omitted = 0 // counts omitted bookmarks too, not folders only
+		for _, child := range e.Children {
+			if !isUrlEntry(child) {
+				c.Children = append(c.Children, copyFolder(child))
+			}
+		}
+		return c
+	}
+	res := *b
+	res.Roots = map[string]*bookmarksEntry{}
+	for k, r := range b.Roots {
+		if r != nil {
+			res.Roots[k] = copyFolder(r)
+		}
+	}
+	return &res
+}
+
+// splitProfiles splits profiles into parts with at most n bookmarks each.
+// Folders spanning multiple parts are repeated in each of them, so every part
+// keeps the full path of the bookmarks it contains.
+func splitProfiles(profiles []*profile, n int) [][]*profile {
+	s := &profilesSplitter{n: n}
+	for _, p := range profiles {
+		for _, k := range rootKeys(p.bookmarks) {
+			s.walk(p, k, nil, p.bookmarks.Roots[k])
+		}
+	}
+	return s.parts
+}
+
+type profilesSplitter struct {
+	n        int
+	count    int
+	parts    [][]*profile
+	profiles map[*profile]*profile               // copies of profiles in the current part
+	folders  map[*bookmarksEntry]*bookmarksEntry // copies of folders in the current part
+}
+
+func (s *profilesSplitter) walk(p *profile, rootKey string, ancestors []*bookmarksEntry, entry *bookmarksEntry) {
+	if isUrlEntry(entry) {
+		if len(s.parts) == 0 || s.count == s.n {
+			s.newPart()
+		}
+		s.count++
+		s.place(p, rootKey, ancestors, entry)
+		return
+	}
+	if len(entry.Children) == 0 {
+		if len(s.parts) == 0 {
+			s.newPart()
+		}
+		s.place(p, rootKey, ancestors, entry)
+		return
+	}
+	ancestors = append(ancestors[:len(ancestors):len(ancestors)], entry)
+	for _, c := range entry.Children {
+		s.walk(p, rootKey, ancestors, c)
+	}
+}
+
+func (s *profilesSplitter) newPart() {
+	s.parts = append(s.parts, nil)
+	s.count = 0
+	s.profiles = map[*profile]*profile{}
+	s.folders = map[*bookmarksEntry]*bookmarksEntry{}
+}
+
+func (s *profilesSplitter) place(p *profile, rootKey string, ancestors []*bookmarksEntry, entry *bookmarksEntry) {
+	pc, ok := s.profiles[p]
+	if !ok {
+		b := &bookmarks{Version: p.bookmarks.Version, Roots: map[string]*bookmarksEntry{}, order: p.bookmarks.order, sections: p.bookmarks.sections, flat: p.bookmarks.flat, barTop: p.bookmarks.barTop}
+		pc = &profile{name: p.name, source: p.source, bookmarks: b}
+		s.profiles[p] = pc
+		last := len(s.parts) - 1
+		s.parts[last] = append(s.parts[last], pc)
+	}
+
+	parent := (*bookmarksEntry)(nil)
+	for _, a := range append(ancestors[:len(ancestors):len(ancestors)], entry) {
+		c, ok := s.folders[a]
+		if !ok {
+			c = a
+			if !isUrlEntry(a) && len(a.Children) != 0 {
+				cc := *a
+				cc.Children = nil
+				c = &cc
+				s.folders[a] = c
+			}
+			if parent == nil {
+				pc.bookmarks.Roots[rootKey] = c
+			} else {
+				parent.Children = append(parent.Children, c)
+			}
+		}
+		parent = c
+	}
+}
+
+// splitOutputPath returns path of the given part of split output.
+func splitOutputPath(path string, part int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s-%03d%s", strings.TrimSuffix(path, ext), part, ext)
+}
+
+func splitNote(path string, part, total int) string {
+	note := fmt.Sprintf("Part %d of %d.", part, total)
+	if part > 1 {
+		note += fmt.Sprintf(" Continued from %s.", filepath.Base(splitOutputPath(path, part-1)))
+	}
+	if part < total {
+		note += fmt.Sprintf(" Continued in %s.", filepath.Base(splitOutputPath(path, part+1)))
+	}
+	return note
+}
+
+// writeSplitDocuments writes profiles split into multiple files, each with at
+// most n bookmarks.
+func writeSplitDocuments(outFormats []outputFormat, paths []string, cfg *config, profiles []*profile, n int) error {
+	parts := splitProfiles(profiles, n)
+	for i, f := range outFormats {
+		for j, part := range parts {
+			note := ""
+			if len(parts) > 1 {
+				note = splitNote(paths[i], j+1, len(parts))
+			}
+			w, err := makeOutput(splitOutputPath(paths[i], j+1), cfg.outputMode)
+			if err != nil {
+				return err
+			}
+			if w, err = wrapOutput(w, cfg); err != nil {
+				return err
+			}
+			err = writeDocument(outputTarget{f.makeFormatter(cfg), w}, part, note, cfg)
+			if cerr := w.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// zipEntryName returns name of zip archive entry for the given profile, unique
+// among already used names.
+func zipEntryName(profile, extension string, used map[string]bool) string {
+	base := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || unicode.IsControl(r) {
+			return '-'
+		}
+		return r
+	}, profile)
+	name := base + extension
+	for i := 2; used[name]; i++ {
+		name = fmt.Sprintf("%s-%d%s", base, i, extension)
+	}
+	used[name] = true
+	return name
+}
+
+// writeZipDocuments writes every profile as a separate document inside zip
+// archive at the given path, together with index.md linking all of them.
+func writeZipDocuments(path string, f outputFormat, cfg *config, profiles []*profile) error {
+	out, err := createFile(path, cfg.outputMode)
+	if err != nil {
+		return err
+	}
+	zw, now := zip.NewWriter(out), time.Now()
+	index := &strings.Builder{}
+	fmt.Fprintf(index, "# Chrome bookmarks\n\n")
+	used := map[string]bool{"index.md": true}
+	for _, p := range profiles {
+		name := zipEntryName(p.name, f.extension, used)
+		ew, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			out.Close()
+			return err
+		}
+		w, err := wrapOutput(stdoutWrapper{ew}, cfg)
+		if err != nil {
+			out.Close()
+			return err
+		}
+		if err := writeDocument(outputTarget{f.makeFormatter(cfg), w}, []*profile{p}, "", cfg); err != nil {
+			out.Close()
+			return err
+		}
+		title, err := cfg.profileTitle(p)
+		if err != nil {
+			out.Close()
+			return err
+		}
+		fmt.Fprintf(index, "- [%s](%s)\n", title, (&url.URL{Path: name}).EscapedPath())
+	}
+	iw, err := zw.CreateHeader(&zip.FileHeader{Name: "index.md", Method: zip.Deflate, Modified: now})
+	if err == nil {
+		_, err = io.WriteString(iw, index.String())
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+type markdownFormatter struct {
+	cfg        *config
+	references []string // URLs referenced in the current profile
+	lastRef    int      // number of the last reference in the document
+}
+
+func (f *markdownFormatter) writeHeader(w io.Writer) error {
+	if err := writef(w, "%s Chrome bookmarks\n", f.cfg.heading(0)); err != nil {
+		return err
+	}
+	if err := writef(w, "\n"); err != nil {
+		return err
+	}
+	if err := writef(w, "> This document was automatically generated by [chrome-bookmarks-to-markdown](https://github.com/daishe/chrome-bookmarks-to-markdown).\n"); err != nil {
+		return err
+	}
+	for _, l := range f.cfg.bannerLines {
+		if err := writef(w, ">\n> %s\n", l); err != nil {
+			return err
+		}
+	}
+	return writef(w, "\n")
+}
+
+func (f *markdownFormatter) writeProfile(w io.Writer, p *profile) error {
+	title, err := f.cfg.profileTitle(p)
+	if err != nil {
+		return err
+	}
+	if err := writef(w, "%s %s\n", f.cfg.heading(1), title); err != nil {
+		return err
+	}
+	if f.cfg.showSourcePath {
+		if err := writef(w, "<!-- source: %s -->\n", p.source.origin); err != nil {
+			return err
+		}
+	}
+	if p.bookmarks.sections {
+		if err := f.writeSections(w, p.bookmarks); err != nil {
+			return err
+		}
+		return f.writeReferences(w)
+	}
+	if err := f.writeEntries(w, topEntries(p.bookmarks), topOmitted(p.bookmarks), ""); err != nil {
+		return err
+	}
+	if err := writef(w, "\n"); err != nil {
+		return err
+	}
+	return f.writeReferences(w)
+}
+
+// writeReferences writes definitions of reference links collected since the
+// last call.
+func (f *markdownFormatter) writeReferences(w io.Writer) error {
+	if len(f.references) == 0 {
+		return nil
+	}
+	first := f.lastRef - len(f.references) + 1
+	for i, u := range f.references {
+		if err := writef(w, "[%d]: %s\n", first+i, markdownLinkDestination(u)); err != nil {
+			return err
+		}
+	}
+	f.references = nil
+	return writef(w, "\n")
+}
+
+func (f *markdownFormatter) writeSections(w io.Writer, b *bookmarks) error {
+	if err := writef(w, "\n"); err != nil {
+		return err
+	}
+	for _, s := range rootEntries(b) {
+		if err := writef(w, "%s %s\n", f.cfg.heading(2), f.escape(s.Name)); err != nil {
+			return err
+		}
+		if err := f.writeEntries(w, s.Children, s.omitted, ""); err != nil {
+			return err
+		}
+		if err := writef(w, "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *markdownFormatter) writeNote(w io.Writer, note string) error {
+	return writef(w, "> %s\n\n", note)
+}
+
+func (f *markdownFormatter) writeSeparator(w io.Writer, separator string) error {
+	return writef(w, "%s\n\n", separator)
+}
+
+func (f *markdownFormatter) writeFooter(w io.Writer) error {
+	return nil
+}
+
+// writeEntries writes the given entries followed by summary of omitted ones.
+func (f *markdownFormatter) writeEntries(w io.Writer, entries []*bookmarksEntry, omitted int, prefix string) error {
+	for _, e := range entries {
+		if err := f.writeEntry(w, e, prefix); err != nil {
+			return err
+		}
+	}
+	if omitted > 0 {
+		return f.writeLine(w, prefix, "- ", omittedLine(omitted))
+	}
+	return nil
+}
+
+func (f *markdownFormatter) writeEntry(w io.Writer, entry *bookmarksEntry, prefix string) error {
+	line := ""
+	if isUrlEntry(entry) && f.cfg.autolinks {
+		line = fmt.Sprintf("%s<%s>%s", f.escape(breadcrumb(entry, " / ")), strings.NewReplacer(" ", "%20", "<", "%3C", ">", "%3E").Replace(entry.Url), f.cfg.annotations(entry))
+	} else if isUrlEntry(entry) && f.cfg.referenceLinks {
+		f.lastRef++
+		f.references = append(f.references, entry.Url)
+		line = fmt.Sprintf("%s[%s][%d]%s", f.escape(breadcrumb(entry, " / ")), f.escape(entry.Name), f.lastRef, f.cfg.annotations(entry))
+	} else if isUrlEntry(entry) {
+		line = fmt.Sprintf("%s[%s](%s)%s", f.escape(breadcrumb(entry, " / ")), f.escape(entry.Name), markdownLinkDestination(entry.Url), f.cfg.annotations(entry))
+	} else {
+		line = fmt.Sprintf("%s%s%s", f.escape(entry.Name), f.cfg.annotations(entry), htmlComments(f.cfg.comments(entry)))
+	}
+	if err := f.writeLine(w, prefix, f.cfg.marker(entry, "- "), line); err != nil {
+		return err
+	}
+	return f.writeEntries(w, entry.Children, entry.omitted, f.nested(prefix))
+}
+
+// writeLine writes a single list item. When wrapping is enabled, line is
+// broken at spaces so that it fits in the configured number of columns (when
+// possible), with continuation lines indented to the item content. Links are
+// never broken.
+func (f *markdownFormatter) writeLine(w io.Writer, prefix, marker, line string) error {
+	if f.cfg.wrap <= 0 {
+		return writef(w, "%s%s%s\n", prefix, marker, line)
+	}
+	cont := prefix + strings.Repeat(" ", utf8.RuneCountInString(marker))
+	width := textWidth(cont)
+	res, col := prefix+marker, textWidth(prefix+marker)
+	for i, word := range splitWrapWords(line) {
+		n := utf8.RuneCountInString(word)
+		if i > 0 && col+1+n > f.cfg.wrap && col > width {
+			res, col = res+"\n"+cont, width
+		} else if i > 0 {
+			res, col = res+" ", col+1
+		}
+		res, col = res+word, col+n
+	}
+	return writef(w, "%s\n", res)
+}
+
+// textWidth returns number of columns taken by the given text, counting tab
+// as 4 columns.
+func textWidth(s string) int {
+	return utf8.RuneCountInString(s) + 3*strings.Count(s, "\t")
+}
+
+// splitWrapWords splits Markdown text at spaces that lie outside of links, so
+// that link text and destination are kept in a single word.
+func splitWrapWords(s string) []string {
+	res, start := []string(nil), 0
+	brackets, parens := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			i++
+		case c == '[':
+			brackets++
+		case c == ']' && brackets > 0:
+			brackets--
+			if brackets == 0 && i+1 < len(s) && s[i+1] == '(' {
+				parens++
+				i++
+			}
+		case c == '(' && parens > 0:
+			parens++
+		case c == ')' && parens > 0:
+			parens--
+		case c == ' ' && brackets == 0 && parens == 0:
+			if i > start {
+				res = append(res, s[start:i])
+			}
+			start = i + 1
+		}
+	}
+	if start < len(s) {
+		res = append(res, s[start:])
+	}
+	return res
+}
+
+// indent returns indentation of a single nesting level, using non-breaking
+// spaces in place of spaces and tabs (tab counts as 4 spaces) when requested.
+func (f *markdownFormatter) indent() string {
+	nbsp := ""
+	switch f.cfg.nbspIndent {
+	case "entity":
+		nbsp = "&nbsp;"
+	case "unicode":
+		nbsp = "\u00a0"
+	default:
+		return f.cfg.indent
+	}
+	r := strings.NewReplacer(" ", nbsp, "\t", strings.Repeat(nbsp, 4))
+	return r.Replace(f.cfg.indent)
+}
+
+// nested returns indentation of children of an entry indented with the given
+// prefix. Once the maximal render depth is reached, children share indentation
+// of their parent.
+func (f *markdownFormatter) nested(prefix string) string {
+	indent := f.indent()
+	if f.cfg.maxRenderDepth > 0 && indent != "" && strings.Count(prefix, indent) >= f.cfg.maxRenderDepth-1 {
+		return prefix
+	}
+	return prefix + indent
+}
+
+var markdownFlavors = []string{"gfm", "commonmark", "pandoc"}
+
+// escape escapes characters of the given text that would be interpreted as
+// Markdown markup by the selected flavor. Underscores are escaped only at word
+// boundaries, as all flavors treat intra-word underscores literally.
+func (f *markdownFormatter) escape(s string) string {
+	special := "\\`*[]<"
+	switch f.cfg.markdownFlavor {
+	case "gfm", "":
+		special += "~|"
+	case "pandoc":
+		special += "~^$@"
+	}
+	rs := []rune(s)
+	sb := strings.Builder{}
+	for i, r := range rs {
+		escape := strings.ContainsRune(special, r)
+		if r == '_' {
+			before := i > 0 && (unicode.IsLetter(rs[i-1]) || unicode.IsDigit(rs[i-1]))
+			after := i+1 < len(rs) && (unicode.IsLetter(rs[i+1]) || unicode.IsDigit(rs[i+1]))
+			escape = !before || !after
+		}
+		if i == 0 && (r == '#' || r == '>') {
+			escape = true
+		}
+		if escape {
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// markdownLinkDestination returns URL in form suitable for Markdown inline
+// link or link reference definition, enclosing it in angle brackets when it
+// contains spaces or parentheses.
+func markdownLinkDestination(u string) string {
+	if strings.ContainsAny(u, " ()<>") {
+		return "<" + strings.NewReplacer("<", "%3C", ">", "%3E").Replace(u) + ">"
+	}
+	return u
+}
+
+// treeFormatter renders bookmarks as plain text tree, similar to the output
+// of the tree command.
+type treeFormatter struct {
+	cfg *config
+}
+
+func (f *treeFormatter) writeHeader(w io.Writer) error {
+	return nil
+}
+
+func (f *treeFormatter) writeProfile(w io.Writer, p *profile) error {
+	title, err := f.cfg.profileTitle(p)
+	if err != nil {
+		return err
+	}
+	if err := writef(w, "%s\n", title); err != nil {
+		return err
+	}
+	if err := f.writeEntries(w, topEntries(p.bookmarks), topOmitted(p.bookmarks), ""); err != nil {
+		return err
+	}
+	return writef(w, "\n")
+}
+
+func (f *treeFormatter) writeNote(w io.Writer, note string) error {
+	return writef(w, "%s\n\n", note)
+}
+
+func (f *treeFormatter) writeSeparator(w io.Writer, separator string) error {
+	return writef(w, "%s\n\n", separator)
+}
+
+func (f *treeFormatter) writeFooter(w io.Writer) error {
+	return nil
+}
+
+// writeEntries writes the given entries followed by summary of omitted ones.
+func (f *treeFormatter) writeEntries(w io.Writer, entries []*bookmarksEntry, omitted int, prefix string) error {
+	for i, e := range entries {
+		last := i == len(entries)-1 && omitted == 0
+		connector, childPrefix := "├── ", "│   "
+		if last {
+			connector, childPrefix = "└── ", "    "
+		}
+		if f.cfg.indentGuides {
+			// guide runs from the folder down to its last entry, so
+			// that every level is marked in the column its folder
+			// begins at
+			if childPrefix = "│ "; last {
+				childPrefix = "  "
+			}
+			if len(e.Children) > 0 || e.omitted > 0 {
+				if connector = "├─┬ "; last {
+					connector = "└─┬ "
+				}
+			}
+		}
+		if isUrlEntry(e) {
+			if err := writef(w, "%s%s%s%s%s (%s)%s\n", prefix, connector, f.cfg.marker(e, ""), breadcrumb(e, " / "), e.Name, e.Url, f.cfg.annotations(e)); err != nil {
+				return err
+			}
+		} else {
+			if err := writef(w, "%s%s%s%s%s%s\n", prefix, connector, f.cfg.marker(e, ""), e.Name, f.cfg.annotations(e), textComments(f.cfg.comments(e))); err != nil {
+				return err
+			}
+		}
+		if err := f.writeEntries(w, e.Children, e.omitted, prefix+childPrefix); err != nil {
+			return err
+		}
+	}
+	if omitted > 0 {
+		return writef(w, "%s└── %s\n", prefix, omittedLine(omitted))
+	}
+	return nil
+}
+
+// urlsFormatter renders bare URLs of all bookmarks, one per line, optionally
+// preceded by tab-separated path of folders (excluding roots).
+type urlsFormatter struct {
+	cfg *config
+}
+
+func (f *urlsFormatter) writeHeader(w io.Writer) error {
+	return nil
+}
+
+func (f *urlsFormatter) writeProfile(w io.Writer, p *profile) error {
+	if p.bookmarks.flat || p.bookmarks.sections {
+		return f.writeEntries(w, topEntries(p.bookmarks), nil)
+	}
+	for _, r := range rootEntries(p.bookmarks) {
+		if err := f.writeEntries(w, r.Children, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *urlsFormatter) writeNote(w io.Writer, note string) error {
+	return nil
+}
+
+func (f *urlsFormatter) writeSeparator(w io.Writer, separator string) error {
+	return nil
+}
+
+func (f *urlsFormatter) writeFooter(w io.Writer) error {
+	return nil
+}
+
+func (f *urlsFormatter) writeEntries(w io.Writer, entries []*bookmarksEntry, path []string) error {
+	for _, e := range entries {
+		if !isUrlEntry(e) {
+			if err := f.writeEntries(w, e.Children, append(path[:len(path):len(path)], e.Name)); err != nil {
+				return err
+			}
+			continue
+		}
+		if f.cfg.urlsWithPath {
+			p := path
+			if len(e.breadcrumb) != 0 {
+				p = e.breadcrumb
+			}
+			if err := writef(w, "%s\t", strings.Join(p, "/")); err != nil {
+				return err
+			}
+		}
+		if err := writef(w, "%s\n", e.Url); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsonlFormatter renders every bookmark as a separate JSON object, one per
+// line (JSON Lines).
+type jsonlFormatter struct {
+	cfg *config
+}
+
+type jsonlEntry struct {
+	Profile string   `json:"profile"`
+	Path    []string `json:"path"`
+	Name    string   `json:"name"`
+	Url     string   `json:"url"`
+}
+
+func (f *jsonlFormatter) writeHeader(w io.Writer) error {
+	return nil
+}
+
+func (f *jsonlFormatter) writeProfile(w io.Writer, p *profile) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	var write func(entries []*bookmarksEntry, path []string) error
+	write = func(entries []*bookmarksEntry, path []string) error {
+		for _, e := range entries {
+			if !isUrlEntry(e) {
+				if err := write(e.Children, append(path[:len(path):len(path)], e.Name)); err != nil {
+					return err
+				}
+				continue
+			}
+			line := jsonlEntry{Profile: p.name, Path: append(path[:len(path):len(path)], e.breadcrumb...), Name: e.Name, Url: e.Url}
+			if line.Path == nil {
+				line.Path = []string{}
+			}
+			if err := enc.Encode(line); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if p.bookmarks.flat || p.bookmarks.sections {
+		return write(topEntries(p.bookmarks), nil)
+	}
+	return write(rootEntries(p.bookmarks), nil)
+}
+
+func (f *jsonlFormatter) writeNote(w io.Writer, note string) error {
+	return nil
+}
+
+func (f *jsonlFormatter) writeSeparator(w io.Writer, separator string) error {
+	return nil
+}
+
+func (f *jsonlFormatter) writeFooter(w io.Writer) error {
+	return nil
+}
+
+// jsonTreeFormatter renders a JSON array with the nested tree of entries of
+// every profile. Empty fields are omitted.
+type jsonTreeFormatter struct {
+	cfg      *config
+	profiles int // number of profiles written so far
+}
+
+type jsonTreeProfile struct {
+	Profile string           `json:"profile"`
+	Entries []*jsonTreeEntry `json:"entries,omitempty"`
+}
+
+type jsonTreeEntry struct {
+	Name     string           `json:"name,omitempty"`
+	Url      string           `json:"url,omitempty"`
+	Children []*jsonTreeEntry `json:"children,omitempty"`
+}
+
+func makeJsonTreeEntries(entries []*bookmarksEntry) []*jsonTreeEntry {
+	res := []*jsonTreeEntry(nil)
+	for _, e := range entries {
+		res = append(res, &jsonTreeEntry{Name: e.Name, Url: e.Url, Children: makeJsonTreeEntries(e.Children)})
+	}
+	return res
+}
+
+func (f *jsonTreeFormatter) writeHeader(w io.Writer) error {
+	f.profiles = 0
+	return writef(w, "[")
+}
+
+func (f *jsonTreeFormatter) writeProfile(w io.Writer, p *profile) error {
+	sep := ",\n"
+	if f.profiles == 0 {
+		sep = "\n"
+	}
+	f.profiles++
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("  ", "  ")
+	if err := enc.Encode(jsonTreeProfile{Profile: p.name, Entries: makeJsonTreeEntries(topEntries(p.bookmarks))}); err != nil {
+		return err
+	}
+	return writef(w, "%s  %s", sep, bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+}
+
+func (f *jsonTreeFormatter) writeNote(w io.Writer, note string) error {
+	return nil
+}
+
+func (f *jsonTreeFormatter) writeSeparator(w io.Writer, separator string) error {
+	return nil
+}
+
+func (f *jsonTreeFormatter) writeFooter(w io.Writer) error {
+	return writef(w, "\n]\n")
+}
+
+// sitemapFormatter renders http(s) bookmarks as sitemap XML document. When
+// dates are shown, date of adding a bookmark is used as its last modification
+// date.
+type sitemapFormatter struct {
+	cfg *config
+}
+
+func (f *sitemapFormatter) writeHeader(w io.Writer) error {
+	if f.cfg.xmlDeclaration {
+		if err := writef(w, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n"); err != nil {
+			return err
+		}
+	}
+	return writef(w, "<urlset xmlns=\"http://www.sitemaps.org/schemas/sitemap/0.9\">\n")
+}
+
+func (f *sitemapFormatter) writeProfile(w io.Writer, p *profile) error {
+	var err error
+	walkBookmarks(p.bookmarks, func(e *bookmarksEntry, depth int) {
+		if err != nil || !isUrlEntry(e) {
+			return
+		}
+		u, perr := url.Parse(e.Url)
+		if perr != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return
+		}
+		err = f.writeUrl(w, e)
+	})
+	return err
+}
+
+func (f *sitemapFormatter) writeUrl(w io.Writer, e *bookmarksEntry) error {
+	if err := writef(w, "  <url>\n    <loc>%s</loc>\n", html.EscapeString(e.Url)); err != nil {
+		return err
+	}
+	if t, ok := chromeTimeToTime(e.DateAdded); ok && f.cfg.showDates {
+		if err := writef(w, "    <lastmod>%s</lastmod>\n", t.Format("2006-01-02")); err != nil {
+			return err
+		}
+	}
+	return writef(w, "  </url>\n")
+}
+
+func (f *sitemapFormatter) writeNote(w io.Writer, note string) error {
+	return writef(w, "  <!-- %s -->\n", strings.ReplaceAll(note, "--", "- -"))
+}
+
+func (f *sitemapFormatter) writeSeparator(w io.Writer, separator string) error {
+	return nil
+}
+
+func (f *sitemapFormatter) writeFooter(w io.Writer) error {
+	return writef(w, "</urlset>\n")
+}
+
+// rstFormatter renders bookmarks as reStructuredText document with nested
+// bullet lists. Bookmarks use anonymous hyperlinks, so that bookmarks sharing
+// a name do not produce duplicate target names.
+type rstFormatter struct {
+	cfg *config
+}
+
+var rstEscaper = strings.NewReplacer("\\", "\\\\", "`", "\\`", "*", "\\*", "_", "\\_", "|", "\\|", "<", "\\<")
+
+func rstHeading(w io.Writer, title string, underline string) error {
+	return writef(w, "%s\n%s\n\n", title, strings.Repeat(underline, utf8.RuneCountInString(title)))
+}
+
+func (f *rstFormatter) writeHeader(w io.Writer) error {
+	if err := rstHeading(w, "Chrome bookmarks", "="); err != nil {
+		return err
+	}
+	if err := writef(w, "This document was automatically generated by `chrome-bookmarks-to-markdown <https://github.com/daishe/chrome-bookmarks-to-markdown>`__.\n\n"); err != nil {
+		return err
+	}
+	for _, l := range f.cfg.bannerLines {
+		if err := f.writeNote(w, l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *rstFormatter) writeProfile(w io.Writer, p *profile) error {
+	title, err := f.cfg.profileTitle(p)
+	if err != nil {
+		return err
+	}
+	if err := rstHeading(w, rstEscaper.Replace(title), "-"); err != nil {
+		return err
+	}
+	if !p.bookmarks.sections {
+		return f.writeEntries(w, topEntries(p.bookmarks), "")
+	}
+	for _, s := range rootEntries(p.bookmarks) {
+		if err := rstHeading(w, rstEscaper.Replace(s.Name), "~"); err != nil {
+			return err
+		}
+		if err := f.writeEntries(w, s.Children, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *rstFormatter) writeNote(w io.Writer, note string) error {
+	return writef(w, "%s\n\n", rstEscaper.Replace(note))
+}
+
+func (f *rstFormatter) writeSeparator(w io.Writer, separator string) error {
+	return writef(w, "%s\n\n", separator)
+}
+
+func (f *rstFormatter) writeFooter(w io.Writer) error {
+	return nil
+}
+
+func (f *rstFormatter) writeEntries(w io.Writer, entries []*bookmarksEntry, prefix string) error {
+	for _, e := range entries {
+		if err := f.writeEntry(w, e, prefix); err != nil {
+			return err
+		}
+	}
+	if len(entries) != 0 {
+		return writef(w, "\n")
+	}
+	return nil
+}
+
+func (f *rstFormatter) writeEntry(w io.Writer, entry *bookmarksEntry, prefix string) error {
+	extra := rstEscaper.Replace(f.cfg.annotations(entry) + textComments(f.cfg.comments(entry)))
+	if isUrlEntry(entry) {
+		return writef(w, "%s- %s`%s <%s>`__%s\n", prefix, rstEscaper.Replace(breadcrumb(entry, " / ")), rstEscaper.Replace(entry.Name), entry.Url, extra)
+	}
+	if err := writef(w, "%s- %s%s\n", prefix, rstEscaper.Replace(entry.Name), extra); err != nil {
+		return err
+	}
+	if len(entry.Children) == 0 {
+		return nil
+	}
+	// nested list must be separated with blank lines and aligned with item text
+	if err := writef(w, "\n"); err != nil {
+		return err
+	}
+	return f.writeEntries(w, entry.Children, prefix+"  ")
+}
+
+// asciidocFormatter renders bookmarks as AsciiDoc document, with nesting
+// expressed by the number of list item markers.
+type asciidocFormatter struct {
+	cfg *config
+}
+
+var asciidocEscaper = strings.NewReplacer(
+	"\\", "\\\\", "*", "\\*", "_", "\\_", "`", "\\`", "#", "\\#", "^", "\\^", "~", "\\~", "+", "\\+", "[", "\\[", "]", "\\]",
+)
+
+// asciidocUrl makes URL safe for use as link macro target.
+func asciidocUrl(rawUrl string) string {
+	return strings.NewReplacer(" ", "%20", "[", "%5B", "]", "%5D").Replace(rawUrl)
+}
+
+func (f *asciidocFormatter) heading(level int) string {
+	return strings.Repeat("=", f.cfg.headingLevel(level))
+}
+
+func (f *asciidocFormatter) writeHeader(w io.Writer) error {
+	if err := writef(w, "%s Chrome bookmarks\n\n", f.heading(0)); err != nil {
+		return err
+	}
+	if err := writef(w, "This document was automatically generated by https://github.com/daishe/chrome-bookmarks-to-markdown[chrome-bookmarks-to-markdown].\n\n"); err != nil {
+		return err
+	}
+	for _, l := range f.cfg.bannerLines {
+		if err := f.writeNote(w, l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *asciidocFormatter) writeProfile(w io.Writer, p *profile) error {
+	title, err := f.cfg.profileTitle(p)
+	if err != nil {
+		return err
+	}
+	if err := writef(w, "%s %s\n\n", f.heading(1), asciidocEscaper.Replace(title)); err != nil {
+		return err
+	}
+	if !p.bookmarks.sections {
+		return f.writeList(w, topEntries(p.bookmarks))
+	}
+	for _, s := range rootEntries(p.bookmarks) {
+		if err := writef(w, "%s %s\n\n", f.heading(2), asciidocEscaper.Replace(s.Name)); err != nil {
+			return err
+		}
+		if err := f.writeList(w, s.Children); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *asciidocFormatter) writeNote(w io.Writer, note string) error {
+	return writef(w, "%s\n\n", asciidocEscaper.Replace(note))
+}
+
+func (f *asciidocFormatter) writeSeparator(w io.Writer, separator string) error {
+	return writef(w, "%s\n\n", separator)
+}
+
+func (f *asciidocFormatter) writeFooter(w io.Writer) error {
+	return nil
+}
+
+func (f *asciidocFormatter) writeList(w io.Writer, entries []*bookmarksEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	if err := f.writeEntries(w, entries, 1); err != nil {
+		return err
+	}
+	return writef(w, "\n")
+}
+
+func (f *asciidocFormatter) writeEntries(w io.Writer, entries []*bookmarksEntry, depth int) error {
+	marker := strings.Repeat("*", depth)
+	for _, e := range entries {
+		extra := asciidocEscaper.Replace(f.cfg.annotations(e) + textComments(f.cfg.comments(e)))
+		if isUrlEntry(e) {
+			if err := writef(w, "%s %slink:%s[%s]%s\n", marker, asciidocEscaper.Replace(breadcrumb(e, " / ")), asciidocUrl(e.Url), asciidocEscaper.Replace(e.Name), extra); err != nil {
+				return err
+			}
+		} else {
+			if err := writef(w, "%s %s%s\n", marker, asciidocEscaper.Replace(e.Name), extra); err != nil {
+				return err
+			}
+		}
+		if err := f.writeEntries(w, e.Children, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orgFormatter renders bookmarks as org-mode document. Profiles and folders
+// become headings, bookmarks become list items. As list items following a
+// heading belong to it, bookmarks of a folder are listed before its
+// subfolders.
+type orgFormatter struct {
+	cfg *config
+}
+
+// orgDescription makes text safe for use as link description or heading.
+func orgDescription(text string) string {
+	return strings.NewReplacer("[", "{", "]", "}").Replace(text)
+}
+
+// orgLinkPath escapes brackets and backslashes in link path.
+func orgLinkPath(rawUrl string) string {
+	return strings.NewReplacer("\\", "\\\\", "[", "\\[", "]", "\\]").Replace(rawUrl)
+}
+
+func (f *orgFormatter) writeHeader(w io.Writer) error {
+	if err := writef(w, "#+TITLE: Chrome bookmarks\n\n"); err != nil {
+		return err
+	}
+	if err := writef(w, "This document was automatically generated by [[https://github.com/daishe/chrome-bookmarks-to-markdown][chrome-bookmarks-to-markdown]].\n\n"); err != nil {
+		return err
+	}
+	for _, l := range f.cfg.bannerLines {
+		if err := f.writeNote(w, l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *orgFormatter) writeProfile(w io.Writer, p *profile) error {
+	title, err := f.cfg.profileTitle(p)
+	if err != nil {
+		return err
+	}
+	if err := writef(w, "* %s\n", orgDescription(title)); err != nil {
+		return err
+	}
+	if !p.bookmarks.sections {
+		return f.writeEntries(w, topEntries(p.bookmarks), 2)
+	}
+	for _, s := range rootEntries(p.bookmarks) {
+		if err := writef(w, "** %s\n", orgDescription(s.Name)); err != nil {
+			return err
+		}
+		if err := f.writeEntries(w, s.Children, 3); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *orgFormatter) writeNote(w io.Writer, note string) error {
+	return writef(w, "%s\n\n", note)
+}
+
+func (f *orgFormatter) writeSeparator(w io.Writer, separator string) error {
+	return writef(w, "%s\n\n", separator)
+}
+
+func (f *orgFormatter) writeFooter(w io.Writer) error {
+	return nil
+}
+
+func (f *orgFormatter) writeEntries(w io.Writer, entries []*bookmarksEntry, depth int) error {
+	for _, e := range entries {
+		if isUrlEntry(e) {
+			extra := orgDescription(f.cfg.annotations(e) + textComments(f.cfg.comments(e)))
+			if err := writef(w, "- %s[[%s][%s]]%s\n", orgDescription(breadcrumb(e, " / ")), orgLinkPath(e.Url), orgDescription(e.Name), extra); err != nil {
+				return err
+			}
+		}
+	}
+	for _, e := range entries {
+		if !isUrlEntry(e) {
+			extra := orgDescription(f.cfg.annotations(e) + textComments(f.cfg.comments(e)))
+			if err := writef(w, "%s %s%s\n", strings.Repeat("*", depth), orgDescription(e.Name), extra); err != nil {
+				return err
+			}
+			if err := f.writeEntries(w, e.Children, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dokuwikiFormatter renders bookmarks as DokuWiki page, with nesting expressed
+// by indentation of list items (two spaces per level).
+type dokuwikiFormatter struct {
+	cfg *config
+}
+
+// dokuwikiMarkup lists sequences starting DokuWiki markup.
+var dokuwikiMarkup = []string{"**", "//", "__", "''", "[[", "]]", "{{", "}}", "((", "))", "<", ">", "~~", "\\\\", "%%", "^", "|"}
+
+// dokuwikiText makes text safe for use in headings and list items, wrapping it
+// in %% (no formatting) when it contains any DokuWiki markup.
+func dokuwikiText(text string) string {
+	for _, m := range dokuwikiMarkup {
+		if strings.Contains(text, m) {
+			return "%%" + strings.ReplaceAll(text, "%%", "% %") + "%%"
+		}
+	}
+	return text
+}
+
+// dokuwikiLinkTitle makes text safe for use as link title.
+var dokuwikiLinkTitle = strings.NewReplacer("[[", "[ [", "]]", "] ]", "{{", "{ {", "}}", "} }")
+
+// dokuwikiUrl makes URL safe for use as link target.
+func dokuwikiUrl(rawUrl string) string {
+	return strings.NewReplacer(" ", "%20", "|", "%7C", "[", "%5B", "]", "%5D").Replace(rawUrl)
+}
+
+// heading returns DokuWiki heading marker for the given level relative to the
+// base heading level. DokuWiki marks top level headings with six equal signs
+// and the lowest (fifth) level with two.
+func (f *dokuwikiFormatter) heading(level int) string {
+	n := 7 - f.cfg.headingLevel(level)
+	if n < 2 {
+		n = 2
+	}
+	return strings.Repeat("=", n)
+}
+
+func (f *dokuwikiFormatter) writeHeader(w io.Writer) error {
+	h := f.heading(0)
+	if err := writef(w, "%s Chrome bookmarks %s\n\n", h, h); err != nil {
+		return err
+	}
+	if err := writef(w, "This document was automatically generated by [[https://github.com/daishe/chrome-bookmarks-to-markdown|chrome-bookmarks-to-markdown]].\n\n"); err != nil {
+		return err
+	}
+	for _, l := range f.cfg.bannerLines {
+		if err := f.writeNote(w, l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *dokuwikiFormatter) writeProfile(w io.Writer, p *profile) error {
+	title, err := f.cfg.profileTitle(p)
+	if err != nil {
+		return err
+	}
+	h := f.heading(1)
+	if err := writef(w, "%s %s %s\n\n", h, dokuwikiText(title), h); err != nil {
+		return err
+	}
+	if !p.bookmarks.sections {
+		return f.writeList(w, topEntries(p.bookmarks))
+	}
+	h = f.heading(2)
+	for _, s := range rootEntries(p.bookmarks) {
+		if err := writef(w, "%s %s %s\n\n", h, dokuwikiText(s.Name), h); err != nil {
+			return err
+		}
+		if err := f.writeList(w, s.Children); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *dokuwikiFormatter) writeNote(w io.Writer, note string) error {
+	return writef(w, "%s\n\n", dokuwikiText(note))
+}
+
+func (f *dokuwikiFormatter) writeSeparator(w io.Writer, separator string) error {
+	return writef(w, "%s\n\n", separator)
+}
+
+func (f *dokuwikiFormatter) writeFooter(w io.Writer) error {
+	return nil
+}
+
+func (f *dokuwikiFormatter) writeList(w io.Writer, entries []*bookmarksEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	if err := f.writeEntries(w, entries, 1); err != nil {
+		return err
+	}
+	return writef(w, "\n")
+}
+
+func (f *dokuwikiFormatter) writeEntries(w io.Writer, entries []*bookmarksEntry, depth int) error {
+	marker := strings.Repeat("  ", depth) + "* "
+	for _, e := range entries {
+		extra := dokuwikiText(f.cfg.annotations(e) + textComments(f.cfg.comments(e)))
+		if isUrlEntry(e) {
+			if err := writef(w, "%s%s[[%s|%s]]%s\n", marker, dokuwikiText(breadcrumb(e, " / ")), dokuwikiUrl(e.Url), dokuwikiLinkTitle.Replace(e.Name), extra); err != nil {
+				return err
+			}
+		} else {
+			if err := writef(w, "%s%s%s\n", marker, dokuwikiText(e.Name), extra); err != nil {
+				return err
+			}
+		}
+		if err := f.writeEntries(w, e.Children, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// htmlFormatter renders bookmarks as a standalone HTML document with nested
+// lists.
+type htmlFormatter struct {
+	cfg *config
+}
+
+const hostBadgesStyle = `<style>
+.host { display: inline-block; margin-left: 0.5em; padding: 0 0.4em; border-radius: 0.6em; background: #e8eaed; color: #3c4043; font-size: 0.8em; }
+</style>
+`
+
+func (f *htmlFormatter) writeHeader(w io.Writer) error {
+	if err := writef(w, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>Chrome bookmarks</title>\n"); err != nil {
+		return err
+	}
+	if f.cfg.hostBadges {
+		if err := writef(w, "%s", hostBadgesStyle); err != nil {
+			return err
+		}
+	}
+	if err := writef(w, "</head>\n<body>\n"); err != nil {
+		return err
+	}
+	l := f.cfg.headingLevel(0)
+	if err := writef(w, "<h%d>Chrome bookmarks</h%d>\n", l, l); err != nil {
+		return err
+	}
+	if err := writef(w, "<p>This document was automatically generated by <a href=\"https://github.com/daishe/chrome-bookmarks-to-markdown\">chrome-bookmarks-to-markdown</a>.</p>\n"); err != nil {
+		return err
+	}
+	for _, l := range f.cfg.bannerLines {
+		if err := f.writeNote(w, l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *htmlFormatter) writeProfile(w io.Writer, p *profile) error {
+	l := f.cfg.headingLevel(1)
+	title, err := f.cfg.profileTitle(p)
+	if err != nil {
+		return err
+	}
+	if err := writef(w, "<h%d>%s</h%d>\n", l, html.EscapeString(title), l); err != nil {
+		return err
+	}
+	if f.cfg.showSourcePath {
+		if err := writef(w, "<!-- source: %s -->\n", p.source.origin); err != nil {
+			return err
+		}
+	}
+	if p.bookmarks.sections {
+		for _, s := range rootEntries(p.bookmarks) {
+			l := f.cfg.headingLevel(2)
+			if err := writef(w, "<h%d>%s</h%d>\n", l, html.EscapeString(s.Name), l); err != nil {
+				return err
+			}
+			if err := f.writeEntries(w, s.Children, ""); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return f.writeEntries(w, topEntries(p.bookmarks), "")
+}
+
+func (f *htmlFormatter) writeNote(w io.Writer, note string) error {
+	return writef(w, "<p>%s</p>\n", html.EscapeString(note))
+}
+
+func (f *htmlFormatter) writeSeparator(w io.Writer, separator string) error {
+	return writef(w, "%s\n", separator)
+}
+
+func (f *htmlFormatter) writeFooter(w io.Writer) error {
+	return writef(w, "</body>\n</html>\n")
+}
+
+func (f *htmlFormatter) writeEntries(w io.Writer, entries []*bookmarksEntry, prefix string) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	if err := writef(w, "%s<ul>\n", prefix); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := f.writeEntry(w, e, prefix+f.cfg.indent); err != nil {
+			return err
+		}
+	}
+	return writef(w, "%s</ul>\n", prefix)
+}
+
+func (f *htmlFormatter) writeEntry(w io.Writer, entry *bookmarksEntry, prefix string) error {
+	annotations := html.EscapeString(f.cfg.annotations(entry))
+	if isUrlEntry(entry) {
+		badge := ""
+		if f.cfg.hostBadges {
+			if u, err := url.Parse(entry.Url); err == nil && u.Hostname() != "" {
+				badge = fmt.Sprintf(" <span class=\"host\">%s</span>", html.EscapeString(u.Hostname()))
+			}
+		}
+		return writef(w, "%s<li>%s<a href=\"%s\">%s</a>%s%s</li>\n", prefix, html.EscapeString(breadcrumb(entry, " / ")), html.EscapeString(entry.Url), html.EscapeString(entry.Name), badge, annotations)
+	}
+	annotations += htmlComments(f.cfg.comments(entry))
+	if len(entry.Children) == 0 {
+		return writef(w, "%s<li>%s%s</li>\n", prefix, html.EscapeString(entry.Name), annotations)
+	}
+	if err := writef(w, "%s<li>%s%s\n", prefix, html.EscapeString(entry.Name), annotations); err != nil {
+		return err
+	}
+	if err := f.writeEntries(w, entry.Children, prefix+f.cfg.indent); err != nil {
+		return err
+	}
+	return writef(w, "%s</li>\n", prefix)
+}
+
+// confluenceFormatter renders bookmarks in Confluence storage format, which is
+// an XHTML fragment: the same markup as HTML format, without the enclosing
+// document elements.
+type confluenceFormatter struct {
+	htmlFormatter
+}
+
+func (f *confluenceFormatter) writeHeader(w io.Writer) error {
+	l := f.cfg.headingLevel(0)
+	if err := writef(w, "<h%d>Chrome bookmarks</h%d>\n", l, l); err != nil {
+		return err
+	}
+	if err := writef(w, "<p>This document was automatically generated by <a href=\"https://github.com/daishe/chrome-bookmarks-to-markdown\">chrome-bookmarks-to-markdown</a>.</p>\n"); err != nil {
+		return err
+	}
+	for _, l := range f.cfg.bannerLines {
+		if err := f.writeNote(w, l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *confluenceFormatter) writeFooter(w io.Writer) error {
+	return nil
+}
+
+// templateFormatter renders the whole document with user provided template.
+// Profiles are collected and the template is executed once all of them are
+// known.
+type templateFormatter struct {
+	cfg      *config
+	document templateDocument
+}
+
+// templateDocument is the data passed to document template.
+type templateDocument struct {
+	Notes    []string
+	Profiles []*templateProfile
+}
+
+type templateProfile struct {
+	Name    string
+	Source  string
+	Entries []*templateEntry
+}
+
+type templateEntry struct {
+	Name       string
+	Breadcrumb []string // folders path in flat output
+	Url        string
+	Guid       string
+	IsFolder   bool
+	DateAdded  time.Time // zero when unknown
+	Depth      int       // 0 for roots
+	Children   []*templateEntry
+}
+
+func makeTemplateEntries(entries []*bookmarksEntry, depth int) []*templateEntry {
+	res := []*templateEntry(nil)
+	for _, e := range entries {
+		te := &templateEntry{Name: e.Name, Breadcrumb: e.breadcrumb, Url: e.Url, Guid: e.Guid, IsFolder: !isUrlEntry(e), Depth: depth}
+		te.DateAdded, _ = chromeTimeToTime(e.DateAdded)
+		te.Children = makeTemplateEntries(e.Children, depth+1)
+		res = append(res, te)
+	}
+	return res
+}
+
+var markdownEscaper = strings.NewReplacer(
+	"\\", "\\\\", "`", "\\`", "*", "\\*", "_", "\\_", "[", "\\[", "]", "\\]",
+	"(", "\\(", ")", "\\)", "<", "\\<", ">", "\\>", "#", "\\#", "|", "\\|",
+)
+
+func urlHost(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// parseTemplateFile parses document template. Besides the standard functions,
+// templates can use indent (indentation for the given depth), escape (escapes
+// Markdown special characters) and host (host of the given URL).
+func parseTemplateFile(path string, cfg *config) (*template.Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return template.New(filepath.Base(path)).Funcs(template.FuncMap{
+		"indent": func(depth int) string { return strings.Repeat(cfg.indent, depth) },
+		"escape": markdownEscaper.Replace,
+		"host":   urlHost,
+	}).Parse(string(data))
+}
+
+func (f *templateFormatter) writeHeader(w io.Writer) error {
+	f.document = templateDocument{}
+	return nil
+}
+
+func (f *templateFormatter) writeProfile(w io.Writer, p *profile) error {
+	f.document.Profiles = append(f.document.Profiles, &templateProfile{
+		Name:    p.name,
+		Source:  p.source.origin,
+		Entries: makeTemplateEntries(topEntries(p.bookmarks), 0),
+	})
+	return nil
+}
+
+func (f *templateFormatter) writeNote(w io.Writer, note string) error {
+	f.document.Notes = append(f.document.Notes, note)
+	return nil
+}
+
+func (f *templateFormatter) writeSeparator(w io.Writer, separator string) error {
+	return nil
+}
+
+func (f *templateFormatter) writeFooter(w io.Writer) error {
+	if f.cfg.template == nil {
+		return errors.New("template format requires --template-file")
+	}
+	return f.cfg.template.Execute(w, &f.document)
+}
+
+// config holds conversion options shared by all formatters.
+type config struct {
+	indent           string
+	nbspIndent       string // one of: "", "entity", "unicode"
+	showDates        bool
+	baseHeadingLevel int
+	hostBadges       bool
+	showSourcePath   bool
+	mergeMarkers     bool
+	outputEncoding   string
+	template         *template.Template
+	maxBytes         int64
+	previewLines     int // write only the given number of lines, 0 writes all
+	flushInterval    int
+	outputMode       os.FileMode // permissions of created files, 0 for default
+	bannerLines      []string    // additional lines of the document banner
+	referenceLinks   bool
+	urlsWithPath     bool
+	orderIndex       bool
+	markdownFlavor   string
+	xmlDeclaration   bool
+	summaryTree      bool
+	profileSeparator string // written between profiles, empty for none
+	emptyPlaceholder string // written in place of empty profiles, empty for none
+	wrap             int
+	autolinks        bool
+	indentGuides     bool
+	maxRenderDepth   int // maximal list nesting level written, 0 for unlimited
+	showLastUsed     bool
+	tagsKey          string // meta info key holding tags shown after bookmarks
+	browser          string
+	profileTemplate  *template.Template
+}
+
+// heading returns Markdown heading marker for the given level relative to the
+// base heading level. Levels are clamped to the range supported by Markdown.
+func (cfg *config) heading(level int) string {
+	return strings.Repeat("#", cfg.headingLevel(level))
+}
+
+// headingLevel returns absolute heading level for the given level relative to
+// the base heading level, clamped to the range 1 to 6.
+func (cfg *config) headingLevel(level int) int {
+	level += cfg.baseHeadingLevel
+	if level < 1 {
+		level = 1
+	}
+	if level > 6 {
+		level = 6
+	}
+	return level
+}
+
+// profileTitleData is the data available to profile title template.
+type profileTitleData struct {
+	Name    string
+	Path    string
+	Browser string
+	Count   int
+}
+
+// profileTitle returns title of the given profile, rendered with profile title
+// template.
+func (cfg *config) profileTitle(p *profile) (string, error) {
+	if cfg.profileTemplate == nil {
+		return "Profile " + p.name, nil
+	}
+	sb := &strings.Builder{}
+	data := profileTitleData{Name: p.name, Path: p.source.origin, Browser: cfg.browser, Count: countBookmarks(p.bookmarks)}
+	if err := cfg.profileTemplate.Execute(sb, data); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// marker returns list item marker of the entry: its original position among
+// siblings when requested, or the given default marker.
+func (cfg *config) marker(entry *bookmarksEntry, def string) string {
+	if cfg.orderIndex && entry.index > 0 {
+		return strconv.Itoa(entry.index) + ". "
+	}
+	return def
+}
+
+// annotations returns text appended to the line of the given entry.
+func (cfg *config) annotations(entry *bookmarksEntry) string {
+	res := ""
+	if cfg.showDates {
+		if t, ok := chromeTimeToTime(entry.DateAdded); ok {
+			res += " (" + t.Format("2006-01-02") + ")"
+		}
+	}
+	if cfg.showLastUsed && isUrlEntry(entry) {
+		if t, ok := chromeTimeToTime(entry.DateLastUsed); ok {
+			res += " (last used " + t.Format("2006-01-02") + ")"
+		} else {
+			res += " (never used)"
+		}
+	}
+	if cfg.tagsKey != "" && isUrlEntry(entry) {
+		for _, t := range entryTags(entry, cfg.tagsKey) {
+			res += " #" + strings.ReplaceAll(t, " ", "-")
+		}
+	}
+	if entry.execResult != "" {
+		res += " [" + entry.execResult + "]"
+	}
+	return res
+}
+
+// comments returns comments attached to the line of the given entry. They are
+// rendered in a way specific to the output format.
+func (cfg *config) comments(entry *bookmarksEntry) []string {
+	res := []string(nil)
+	if cfg.mergeMarkers && len(entry.mergedFrom) > 1 {
+		res = append(res, "merged from: "+strings.Join(entry.mergedFrom, ", "))
+	}
+	return res
+}
+
+func textComments(comments []string) string {
+	res := ""
+	for _, c := range comments {
+		res += " [" + c + "]"
+	}
+	return res
+}
+
+func htmlComments(comments []string) string {
+	res := ""
+	for _, c := range comments {
+		res += " <!-- " + c + " -->"
+	}
+	return res
+}
+
+func normalizeProfileName(name string) string {
+	return strings.Trim(strings.ReplaceAll(name, string(os.PathSeparator), "/"), "/")
+}
+
+// profilesFilter selects profiles for output by their normalized names.
+// Filter without any names selects all profiles.
+type profilesFilter struct {
+	names      map[string]bool
+	prefix     bool             // names match any profile they are prefix of
+	ignoreCase bool             // names are compared case-insensitively
+	patterns   []*regexp.Regexp // profiles matching any of patterns are included too
+}
+
+// key returns form of the profile name used for comparisons.
+func (pf *profilesFilter) key(name string) string {
+	name = normalizeProfileName(name)
+	if pf.ignoreCase {
+		name = strings.ToLower(name)
+	}
+	return name
+}
+
+func (pf *profilesFilter) add(names ...string) {
+	for _, n := range names {
+		if n = pf.key(strings.TrimSpace(n)); n != "" {
+			if pf.names == nil {
+				pf.names = map[string]bool{}
+			}
+			pf.names[n] = true
+		}
+	}
+}
+
+func (pf *profilesFilter) includes(name string) bool {
+	if len(pf.names) == 0 && len(pf.patterns) == 0 {
+		return true
+	}
+	for _, p := range pf.patterns {
+		if p.MatchString(name) {
+			return true
+		}
+	}
+	name = pf.key(name)
+	if pf.names[name] {
+		return true
+	}
+	if pf.prefix {
+		for n := range pf.names {
+			if strings.HasPrefix(name, n) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// readListFile reads list of values from a file, one per line. Blank lines
+// and lines starting with # are ignored.
+func readListFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	res := []string(nil)
+	for _, l := range strings.Split(string(data), "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		res = append(res, l)
+	}
+	return res, nil
+}
+
+// formatThousands formats number with comma as thousands separator.
+func formatThousands(n int) string {
+	s := strconv.Itoa(n)
+	sign := ""
+	if n < 0 {
+		sign, s = "-", s[1:]
+	}
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return sign + s
+}
+
+func plural(n int, singular, plural string) string {
+	if n == 1 {
+		return singular
+	}
+	return plural
+}
+
+// bannerStats returns banner line with number of bookmarks and profiles.
+func bannerStats(profiles []*profile) string {
+	total := 0
+	for _, p := range profiles {
+		total += countBookmarks(p.bookmarks)
+	}
+	return fmt.Sprintf("%s %s across %s %s.", formatThousands(total), plural(total, "bookmark", "bookmarks"), formatThousands(len(profiles)), plural(len(profiles), "profile", "profiles"))
+}
+
+// countBookmarks returns number of bookmarks (excluding folders).
+func countBookmarks(b *bookmarks) int {
+	res := 0
+	walkBookmarks(b, func(e *bookmarksEntry, depth int) {
+		if depth > 0 && isUrlEntry(e) {
+			res++
+		}
+	})
+	return res
+}
+
+// isEmptyProfile reports whether there is nothing but roots in the profile.
+func isEmptyProfile(p *profile) bool {
+	empty := true
+	walkBookmarks(p.bookmarks, func(e *bookmarksEntry, depth int) {
+		empty = empty && depth == 0
+	})
+	return empty
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// selectProfiles lets the user interactively toggle which of the given
+// profiles should be converted. It returns selection state of each profile.
+func selectProfiles(r io.Reader, w io.Writer, names []string, counts []int) ([]bool, error) {
+	selected := make([]bool, len(names))
+	for i := range selected {
+		selected[i] = true
+	}
+	s := bufio.NewScanner(r)
+	for {
+		for i, n := range names {
+			mark := " "
+			if selected[i] {
+				mark = "x"
+			}
+			if err := writef(w, "%3d. [%s] %s (%d bookmarks)\n", i+1, mark, n, counts[i]); err != nil {
+				return nil, err
+			}
+		}
+		if err := writef(w, "Toggle profiles by numbers (separated with spaces or commas), a for all, n for none, empty line to continue: "); err != nil {
+			return nil, err
+		}
+		if !s.Scan() {
+			if err := s.Err(); err != nil {
+				return nil, err
+			}
+			return selected, nil
+		}
+		line := strings.TrimSpace(s.Text())
+		switch line {
+		case "":
+			return selected, nil
+		case "a", "n":
+			for i := range selected {
+				selected[i] = line == "a"
+			}
+			continue
+		}
+		for _, f := range strings.FieldsFunc(line, func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) {
+			i, err := strconv.Atoi(f)
+			if err != nil || i < 1 || i > len(names) {
+				if err := writef(w, "Invalid profile number %q\n", f); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			selected[i-1] = !selected[i-1]
+		}
+	}
+}
+
+func showVersion() {
+	fmt.Printf("Version of application: %s, commit: %s\n", Version, Commit)
+	fmt.Printf("\n")
+	fmt.Printf("Copyright 2022 Marek Dalewski. License: Apache License 2.0\n")
+	fmt.Printf("\n")
+	fmt.Printf("You should have received a copy of the Apache License 2.0 along with this program. If not, see <https://www.apache.org/licenses/LICENSE-2.0>.\n")
+}
+
+// listFlag is a string flag that can be given multiple times, values of all
+// occurrences are joined with commas. The default value is replaced by the
+// first occurrence.
+type listFlag struct {
+	value *string
+	set   bool
+}
+
+func newListFlag(p *string, value string) *listFlag {
+	*p = value
+	return &listFlag{value: p}
+}
+
+func (l *listFlag) String() string {
+	if l == nil || l.value == nil {
+		return ""
+	}
+	return *l.value
+}
+
+func (l *listFlag) Set(s string) error {
+	if l.set {
+		s = *l.value + "," + s
+	}
+	*l.value, l.set = s, true
+	return nil
+}
+
+// versionBanner returns banner line with version and commit of the
+// application.
+func versionBanner() string {
+	v := Version
+	if v != "" && unicode.IsDigit(rune(v[0])) {
+		v = "v" + v
+	}
+	return fmt.Sprintf("Generated by chrome-bookmarks-to-markdown %s (commit %s).", v, Commit)
+}
+
+func main() {
+	defaultInput, _ := defaultChromeConfigLocation() // on error user should provide path with flag
+
+	browser := flag.String("browser", "chrome", "browser the bookmarks come from, one of: chrome, safari")
+	input := new(string)
+	flag.Var(newListFlag(input, defaultInput), "input", "path containing Chrome configuration or zip archive with its backup, use - to read a single bookmarks file from stdin or HTTP(S) URL to download it; for Safari path to Bookmarks.plist file; multiple comma separated paths (or repeated flags) containing Chrome configuration are searched together")
+	recursiveGlob := flag.String("recursive-glob", "", "like --glob, but ** matches any number of directories, like 'backups/**/Bookmarks', each file becomes a profile named after its path")
+	glob := flag.String("glob", "", "glob pattern of bookmarks files to convert, used instead of --input, each file becomes a profile named after the file")
+	devtoolsUrl := flag.String("devtools-url", "", "URL of DevTools endpoint of running Chrome (started with --remote-debugging-port and --enable-automation), bookmarks are read from the user data directory it reports")
+	output := flag.String("output", "", "output path for storing generated document, leave empty for stdout")
+	outputZip := flag.String("output-zip", "", "path of zip archive to write, with every profile as a separate document and index.md linking them, used instead of --output")
+	inputTimeout := flag.Duration("input-timeout", 30*time.Second, "timeout for downloading input given as HTTP(S) URL")
+	verifyChecksumFlag := flag.Bool("verify-checksum", false, "warn when checksum stored in Chrome bookmarks file does not match its content, which indicates corruption or modification outside of Chrome")
+	strictJson := flag.Bool("strict-json", false, "report fields of bookmarks files not known to this tool as errors, to diagnose changes of the file format (Chrome adds new fields over time)")
+	readRetries := flag.Int("read-retries", 0, "number of times reading of bookmarks files and searching for them is retried after a failure, useful for network file systems")
+	readRetryDelay := flag.Duration("read-retry-delay", 100*time.Millisecond, "delay before the first retry of a failed read, doubled before every next one")
+	maxScanDepth := flag.Int("max-scan-depth", 25, "maximal depth of directories searched for profiles, 0 means only the input directory itself")
+	maxNesting := flag.Int("max-nesting", 1000, "maximal nesting of folders processed in bookmarks files (deeper content is skipped with an error), also limits --max-scan-depth")
+	followSymlinks := flag.Bool("follow-symlinks", false, "follow symbolic links to directories when searching for profiles")
+	outputMode := flag.String("output-mode", "", "permissions of written output files as an octal number, like 0600, leave empty for default ones")
+	outputEncoding := flag.String("output-encoding", "utf-8", "encoding of generated document, one of: "+strings.Join(outputEncodings, ", "))
+	preview := flag.Int("preview", 0, "print only the first N lines of the generated document to stdout (ignoring --output), for a quick check of formatting")
+	maxBytes := flag.Int64("max-bytes", 0, "stop writing output after the given number of bytes (counted in UTF-8), at a line boundary, and append truncation notice; 0 disables the limit")
+	flushInterval := flag.Int("flush-interval", 0, "sync output after every N written lines (roughly one per bookmark), 0 syncs only at the end")
+	profiles := flag.String("profiles", "", "comma separated list of profile names that should be included in output, leave empty for all profiles")
+	profilesPrefix := flag.Bool("profiles-prefix", false, "match profiles which names start with any of the given profile names, instead of exact matching")
+	profilesIgnoreCase := flag.Bool("profiles-ignore-case", false, "compare profile names given with --profiles, --profiles-file and --profiles-regex case-insensitively")
+	profilesRegex := flag.String("profiles-regex", "", "regular expression matched against profile names (paths relative to input), matching profiles are included in output in addition to --profiles")
+	profilesFile := flag.String("profiles-file", "", "path to file with profile names that should be included in output, one per line, combined with --profiles")
+	indent := flag.String("indent", "\\t", "string used for indentation")
+	maxRenderDepth := flag.Int("max-render-depth", 0, "in markdown format maximal list nesting level written, deeper entries are written at this level, 0 for unlimited")
+	profileNameTemplate := flag.String("profile-name-template", "Profile {{.Name}}", "Go text/template rendering title of each profile, with .Name, .Path, .Browser and .Count (number of bookmarks) fields")
+	format := flag.String("format", "markdown", "comma separated list of output formats, one or more of: "+strings.Join(formatNames(), ", "))
+	templateFile := flag.String("template-file", "", "path to Go text/template rendering the whole document, implies --format template unless --format is set")
+	xmlDeclaration := flag.Bool("xml-declaration", true, "start XML documents (sitemap format) with <?xml ...?> declaration, use --xml-declaration=false to omit it")
+	markdownFlavor := flag.String("markdown-flavor", "gfm", "Markdown dialect whose rules are used for escaping, one of: "+strings.Join(markdownFlavors, ", "))
+	wrap := flag.Int("wrap", 0, "in Markdown format wrap list lines longer than N columns, without breaking links, 0 disables wrapping")
+	nbspIndent := flag.String("nbsp-indent", "", "in Markdown format render indentation with non-breaking spaces, one of: entity (&nbsp;), unicode (U+00A0), leave empty to disable")
+	baseHeadingLevel := flag.Int("base-heading-level", 1, "heading level of the document title, profile headings use the next level")
+	excludeGuids := flag.String("exclude-guids", "", "comma separated list of GUIDs of bookmarks and folders that should be excluded from output")
+	excludeGuidsFile := flag.String("exclude-guids-file", "", "path to file with GUIDs of bookmarks and folders that should be excluded from output, one per line, combined with --exclude-guids")
+	urlByUrlField := flag.Bool("url-by-url-field", false, "treat every entry with non-empty URL as a bookmark, even if its type says otherwise")
+	normalizeHosts := flag.Bool("normalize-hosts", false, "lowercase scheme and host of every bookmark URL")
+	stripFragments := flag.Bool("strip-fragments", false, "remove fragment (#anchor) from every bookmark URL")
+	stripQuery := flag.Bool("strip-query", false, "remove query string from every bookmark URL")
+	autolinks := flag.Bool("only-urls-no-names", false, "in Markdown format render bookmarks as bare autolinks (<url>), without names")
+	referenceLinks := flag.Bool("reference-links", false, "in Markdown format render bookmarks as reference-style links, with URLs listed at the end of each profile")
+	urlsWithPath := flag.Bool("urls-with-path", false, "in urls format precede each URL with tab-separated path of its folders")
+	indentGuides := flag.Bool("indent-guides", false, "in tree format draw vertical guide from every folder down to its last entry, indenting nesting levels by two columns")
+	hostBadges := flag.Bool("host-badges", false, "in HTML format show host of each bookmark as a badge")
+	sortUrls := flag.String("sort", "none", "sort order of bookmarks within a folder, one of: "+strings.Join(sortOrders, ", "))
+	sortTiebreak := flag.String("sort-tiebreak", "none", "secondary sort key ordering entries equal according to --sort and --sort-folders, one of: "+strings.Join(sortTiebreaks, ", "))
+	sortCaseSensitive := flag.Bool("sort-case-sensitive", false, "compare names case-sensitively (byte order) when sorting by name, so that Zebra goes before apple")
+	orderIndex := flag.Bool("preserve-manual-order-with-index", false, "in Markdown and tree formats prefix every entry with its position among siblings in the bookmarks file, regardless of sorting")
+	sortFolders := flag.String("sort-folders", "none", "sort order of folders within a folder, one of: "+strings.Join(sortOrders, ", "))
+	mergeProfilesFlag := flag.Bool("merge-profiles", false, "merge all profiles into a single section, combining folders with the same path")
+	mergeMarkers := flag.Bool("merge-markers", false, "with --merge-profiles annotate merged folders with a comment listing contributing profiles")
+	dedupe := flag.Bool("dedupe", false, "remove bookmarks with duplicated URLs")
+	dedupeKeep := flag.String("dedupe-keep", "first", "with --dedupe which occurrence of duplicated bookmark is kept (shortest keeps the shortest URL and, with url key, treats URLs differing only in query string, fragment or trailing slash as duplicates), one of: "+strings.Join(dedupeStrategies, ", "))
+	dedupeStripWww := flag.Bool("dedupe-strip-www", false, "ignore leading www. of hosts when finding duplicated bookmarks (--dedupe, --dedupe-report) and grouping them (--group-by)")
+	dedupeBy := flag.String("dedupe-by", "url", "with --dedupe what identifies duplicated bookmarks (title compares names ignoring case), one of: "+strings.Join(dedupeKeys, ", "))
+	dedupeReport := flag.Bool("dedupe-report", false, "instead of generating document, report groups of bookmarks with duplicated URLs and their folders, as markdown or json (selected with --format)")
+	domainStatsFlag := flag.Bool("domain-stats", false, "instead of generating document, report numbers of bookmarks per domain (most bookmarked first), as markdown or csv (selected with --format)")
+	crossProfileDupes := flag.Bool("cross-profile-dupes", false, "instead of generating document, report bookmarks with URLs present in more than one profile, as markdown or json (selected with --format)")
+	redact := flag.Bool("redact", false, "replace URLs with their short stable hashes, keeping names and folder structure")
+	stripEmojiFlag := flag.Bool("strip-emoji", false, "remove emoji and pictographic symbols from names of bookmarks and folders")
+	nameReplace := flag.String("name-replace", "", "comma separated list of old=new replacements applied in order to names of bookmarks and folders, like 'TODO: =' to strip a prefix")
+	nameReplaceRegex := flag.Bool("name-replace-regex", false, "treat old parts of --name-replace as regular expressions, new parts can refer to their groups with $1")
+	nameCase := flag.String("name-case", "none", "change case of names of bookmarks and folders, one of: "+strings.Join(nameCases, ", "))
+	redactNames := flag.Bool("redact-names", false, "replace names of bookmarks and folders with their short stable hashes")
+	groupBy := flag.String("group-by", "none", "list bookmarks without folders, grouped by their host (domain), registered domain (tld, like github.com for gist.github.com, using common public suffixes like co.uk or github.io, other hosts are reduced to their last two labels), tags (tag, requires --tags-key) or date of adding (date, see --date-bucket), one of: "+strings.Join(groupByKeys, ", "))
+	dateBucket := flag.String("date-bucket", "month", "with --group-by date the period bookmarks are grouped by, one of: day, month, year")
+	alphaIndexFlag := flag.Bool("alpha-index", false, "list bookmarks without folders, grouped by the first letter of their names")
+	onlyFolders := flag.Bool("only-folders", false, "list only folders, without bookmarks")
+	skipEmptyFolders := flag.Bool("skip-empty-folders", false, "omit folders that do not contain any bookmarks (roots are always listed)")
+	promoteBookmarkBar := flag.Bool("promote-bookmark-bar", false, "list content of bookmarks bar directly under profile heading, instead of in a separate folder")
+	flat := flag.Bool("flat", false, "list bookmarks without nesting, each preceded with path of its folders")
+	emptyPlaceholder := flag.String("empty-placeholder", defaultEmptyPlaceholder, "text written under profiles without any bookmarks or folders, and in place of profiles when none is left (formats other than markdown write the default without emphasis), leave empty to disable")
+	profileSeparator := flag.String("profile-separator", "", "text written between profiles (as is, followed by an empty line), like --- for Markdown horizontal rule, \\n can be used for new lines; ignored by json-tree, jsonl, urls, sitemap and template formats")
+	summaryTree := flag.Bool("summary-tree", false, "precede the full listing with an overview of folders (like --only-folders output)")
+	combineRootsFlag := flag.Bool("combine-roots", false, "list children of all roots as one sequence, without rendering the roots themselves")
+	combineRootsMerge := flag.Bool("combine-roots-merge-folders", false, "with --combine-roots merge folders of the same name coming from different roots")
+	flatIncludeProfile := flag.Bool("flat-include-profile", false, "with --flat or --recent include profile name in front of folders path")
+	maxChildren := flag.Int("max-children", 0, "list at most N entries of every folder, 0 lists all entries; markdown and tree formats follow them with the number of omitted ones")
+	recent := flag.Int("recent", 0, "list only N most recently added bookmarks of each profile, newest first, without nesting (like --flat), 0 lists all bookmarks")
+	execFlag := flag.String("exec", "", "command run for every bookmark, with URL in place of {} placeholders or appended as the last argument, arguments are separated with white space")
+	execConcurrency := flag.Int("exec-concurrency", 4, "maximal number of commands run at once with --exec")
+	execTimeout := flag.Duration("exec-timeout", 30*time.Second, "timeout of a single command run with --exec, 0 disables the timeout")
+	expandShortUrls := flag.Bool("expand-short-urls", false, "replace URLs of well known shortening services (like bit.ly or t.co) with URLs they redirect to, found with HTTP HEAD requests")
+	shortUrlHosts := flag.String("short-url-hosts", "", "comma separated list of additional hosts of URL shortening services expanded with --expand-short-urls")
+	expandConcurrency := flag.Int("expand-concurrency", 4, "maximal number of requests made at once with --expand-short-urls")
+	expandTimeout := flag.Duration("expand-timeout", 10*time.Second, "timeout of expanding a single URL with --expand-short-urls (including all redirects)")
+	maxConcurrency := flag.Int("max-concurrency", 0, "maximal number of concurrent operations (like commands run with --exec) in total, shared by all features working concurrently, 0 disables the limit")
+	execAnnotate := flag.Bool("exec-annotate", false, "annotate bookmarks with outcome of the command run with --exec")
+	watch := flag.Bool("watch", false, "keep running and regenerate output whenever any of the bookmarks files changes, until interrupted")
+	watchInterval := flag.Duration("watch-interval", time.Second, "with --watch how often bookmarks files are checked for changes")
+	watchDebounce := flag.Duration("watch-debounce", 2*time.Second, "with --watch how long bookmarks files have to stay unchanged before output is regenerated")
+	showVersionInBanner := flag.Bool("show-version-in-banner", false, "include version and commit of this tool in the document banner")
+	bannerStatsFlag := flag.Bool("banner-stats", false, "include total number of bookmarks and profiles in the document banner")
+	showSourcePath := flag.Bool("show-source-path", false, "include path of the source bookmarks file as a comment under each profile heading")
+	showDates := flag.Bool("show-dates", false, "annotate bookmarks and folders with the date they were added, in sitemap format used as last modification date")
+	tagsKey := flag.String("tags-key", "", "meta_info key holding comma separated tags of bookmarks, shown as #tag after them and used by --group-by tag")
+	showLastUsed := flag.Bool("show-last-used", false, "annotate bookmarks with the date they were last used")
+	addedWithin := flag.String("added-within", "", "list only bookmarks added within the given time from now, like 30d, 2w or 12h")
+	unusedSince := flag.String("unused-since", "", "list only stale bookmarks, not used since the given date (YYYY-MM-DD), including never used ones")
+	warnDups := flag.Bool("warn-duplicates", false, "report bookmarks sharing a name with another bookmark in the same folder")
+	splitEvery := flag.Int("split-every", 0, "start a new output file after every N bookmarks, requires --output, 0 disables splitting")
+	keepGoing := flag.Bool("keep-going", false, "report bookmarks files that cannot be loaded and continue with the remaining ones, failing only at the end")
+	interactive := flag.Bool("interactive", false, "interactively select profiles to convert, when running in a terminal")
+	validateUrlsFlag := flag.Bool("validate-urls", false, "report bookmarks with malformed URLs (not parsable, without scheme or with white space) as warnings, without any network access")
+	warningsAsErrors := flag.Bool("warnings-as-errors", false, "with --validate-urls fail without generating output when malformed URLs are found")
+	validate := flag.Bool("validate", false, "only check integrity of Chrome bookmarks files and report problems, without generating output")
+	logFile := flag.String("log-file", "", "path of file to append a line describing the run to (input, profiles, number of bookmarks and errors), for auditing scheduled runs")
+	version := flag.Bool("version", false, "show version information")
+	flag.Parse()
+
+	if *version {
+		showVersion()
+		os.Exit(0)
+	}
+
+	if *logFile != "" {
+		runLog = &runRecord{path: *logFile, started: time.Now()}
+		defer runLog.write(0)
+	}
+
+	inputSet, formatSet := false, false
+	flag.Visit(func(f *flag.Flag) {
+		inputSet = inputSet || f.Name == "input"
+		formatSet = formatSet || f.Name == "format"
+	})
+	switch *browser {
+	case "chrome":
+	case "safari":
+		if *validate {
+			fatal(errors.New("--validate checks the layout of Chrome bookmarks files only, it cannot be used with --browser safari"))
+		}
+		if !inputSet {
+			p, err := defaultSafariBookmarksLocation()
+			fatal(err)
+			*input = p
+		}
+	default:
+		fatal(fmt.Errorf("unknown browser %q, expected chrome or safari", *browser))
+	}
+
+	if !isUrlInput(*input) {
+		*input = filepath.Clean(*input)
+	}
+
+	selectedProfiles := &profilesFilter{prefix: *profilesPrefix, ignoreCase: *profilesIgnoreCase}
+	selectedProfiles.add(strings.Split(*profiles, ",")...)
+	if *profilesFile != "" {
+		names, err := readListFile(*profilesFile)
+		fatal(err)
+		selectedProfiles.add(names...)
+	}
+	if *profilesRegex != "" {
+		pattern := *profilesRegex
+		if *profilesIgnoreCase {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		fatal(err)
+		selectedProfiles.patterns = append(selectedProfiles.patterns, re)
+	}
+
+	if *maxScanDepth < 0 {
+		fatal(fmt.Errorf("max scan depth must not be negative, got %d", *maxScanDepth))
+	}
+	if *readRetries < 0 {
+		fatal(fmt.Errorf("read retries must not be negative, got %d", *readRetries))
+	}
+	if *wrap < 0 {
+		fatal(fmt.Errorf("wrap must not be negative, got %d", *wrap))
+	}
+	if *groupBy == "tag" && *tagsKey == "" {
+		fatal(errors.New("--group-by tag requires --tags-key"))
+	}
+	if *maxConcurrency < 0 {
+		fatal(fmt.Errorf("max concurrency must not be negative, got %d", *maxConcurrency))
+	}
+	shared := newLimiter(*maxConcurrency)
+	if *preview < 0 {
+		fatal(fmt.Errorf("preview must not be negative, got %d", *preview))
+	}
+	if *maxChildren < 0 {
+		fatal(fmt.Errorf("max children must not be negative, got %d", *maxChildren))
+	}
+	if *recent < 0 {
+		fatal(fmt.Errorf("recent must not be negative, got %d", *recent))
+	}
+	fileMode := os.FileMode(0)
+	if *outputMode != "" {
+		m, err := strconv.ParseUint(*outputMode, 8, 32)
+		if err != nil || m == 0 || m > 0777 {
+			fatal(fmt.Errorf("invalid output mode %q, expected octal permissions between 0001 and 0777", *outputMode))
+		}
+		fileMode = os.FileMode(m)
+	}
+	if *flushInterval < 0 {
+		fatal(fmt.Errorf("flush interval must not be negative, got %d", *flushInterval))
+	}
+	if *maxRenderDepth < 0 {
+		fatal(fmt.Errorf("max render depth must not be negative, got %d", *maxRenderDepth))
+	}
+	if *maxNesting < 1 {
+		fatal(fmt.Errorf("max nesting must be positive, got %d", *maxNesting))
+	}
+	if *maxScanDepth > *maxNesting {
+		*maxScanDepth = *maxNesting
+	}
+
+	if *nbspIndent != "" && *nbspIndent != "entity" && *nbspIndent != "unicode" {
+		fatal(fmt.Errorf("unknown non-breaking space indentation %q, expected entity or unicode", *nbspIndent))
+	}
+
+	switch *markdownFlavor {
+	case "gfm", "commonmark", "pandoc":
+	default:
+		fatal(fmt.Errorf("unknown markdown flavor %q, expected one of: %s", *markdownFlavor, strings.Join(markdownFlavors, ", ")))
+	}
+
+	if *baseHeadingLevel < 1 || *baseHeadingLevel > 6 {
+		fatal(fmt.Errorf("base heading level must be between 1 and 6, got %d", *baseHeadingLevel))
+	}
+
+	staleBefore := time.Time{}
+	if *unusedSince != "" {
+		t, err := time.Parse("2006-01-02", *unusedSince)
+		fatal(err)
+		staleBefore = t
+	}
+
+	addedAfter := time.Time{}
+	if *addedWithin != "" {
+		d, err := parseDays(*addedWithin)
+		fatal(err)
+		addedAfter = time.Now().Add(-d)
+	}
+
+	replacer, err := nameReplacer(*nameReplace, *nameReplaceRegex)
+	fatal(err)
+	caser, err := nameCaser(*nameCase)
+	fatal(err)
+	urlsLess, err := entriesComparator(*sortUrls, *sortCaseSensitive)
+	fatal(err)
+	urlsLess, err = withTiebreak(urlsLess, *sortTiebreak, *sortCaseSensitive)
+	fatal(err)
+	foldersLess, err := entriesComparator(*sortFolders, *sortCaseSensitive)
+	fatal(err)
+	foldersLess, err = withTiebreak(foldersLess, *sortTiebreak, *sortCaseSensitive)
+	fatal(err)
+
+	excludedGuids := map[string]bool{}
+	for _, g := range strings.Split(*excludeGuids, ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			excludedGuids[g] = true
+		}
+	}
+	if *excludeGuidsFile != "" {
+		guids, err := readListFile(*excludeGuidsFile)
+		fatal(err)
+		for _, g := range guids {
+			excludedGuids[g] = true
+		}
+	}
+
+	*indent = strings.ReplaceAll(*indent, "\\t", "\t")
+	*indent = strings.ReplaceAll(*indent, "\\n", "\n")
+	*indent = strings.ReplaceAll(*indent, "\\r", "\r")
+
+	cfg := &config{
+		indent:           *indent,
+		nbspIndent:       *nbspIndent,
+		showDates:        *showDates,
+		baseHeadingLevel: *baseHeadingLevel,
+		hostBadges:       *hostBadges,
+		referenceLinks:   *referenceLinks,
+		urlsWithPath:     *urlsWithPath,
+		orderIndex:       *orderIndex,
+		markdownFlavor:   *markdownFlavor,
+		xmlDeclaration:   *xmlDeclaration,
+		summaryTree:      *summaryTree,
+		profileSeparator: strings.ReplaceAll(*profileSeparator, "\\n", "\n"),
+		emptyPlaceholder: *emptyPlaceholder,
+		wrap:             *wrap,
+		autolinks:        *autolinks,
+		indentGuides:     *indentGuides,
+		showLastUsed:     *showLastUsed,
+		tagsKey:          *tagsKey,
+		browser:          *browser,
+		showSourcePath:   *showSourcePath,
+		mergeMarkers:     *mergeMarkers,
+		outputEncoding:   *outputEncoding,
+		maxBytes:         *maxBytes,
+		previewLines:     *preview,
+		maxRenderDepth:   *maxRenderDepth,
+		flushInterval:    *flushInterval,
+		outputMode:       fileMode,
+	}
+
+	if *devtoolsUrl != "" {
+		*input, err = devtoolsUserDataDir(*devtoolsUrl, *inputTimeout)
+		fatal(err)
+	}
+	inputName := *input
+	if *glob != "" {
+		inputName = *glob
+	}
+	if *recursiveGlob != "" {
+		inputName = *recursiveGlob
+	}
+	runLog.setInput(inputName)
+	sources := []bookmarksSource(nil)
+	if *browser == "safari" {
+		sources = []bookmarksSource{safariSource(*input)}
+		if *input == "-" {
+			sources[0] = stdinSource()
+			sources[0].parse = parseSafariBookmarks
+		}
+	} else if *recursiveGlob != "" {
+		fatal(withRetries(*readRetries, *readRetryDelay, "searching "+inputName, func() error {
+			sources, err = recursiveGlobSources(*recursiveGlob)
+			return err
+		}))
+	} else if *glob != "" {
+		fatal(withRetries(*readRetries, *readRetryDelay, "searching "+inputName, func() error {
+			sources, err = globSources(*glob)
+			return err
+		}))
+	} else if *input == "-" {
+		sources = []bookmarksSource{stdinSource()}
+	} else if isUrlInput(*input) {
+		src, err := urlSource(*input, *inputTimeout)
+		fatal(err)
+		sources = []bookmarksSource{src}
+	} else if strings.EqualFold(filepath.Ext(*input), ".zip") {
+		var closer io.Closer
+		sources, closer, err = findZipSources(*input)
+		fatal(err)
+		defer closer.Close()
+	} else {
+		fatal(withRetries(*readRetries, *readRetryDelay, "searching "+inputName, func() error {
+			sources, err = findInputsSources(inputPaths(*input), *maxScanDepth, *followSymlinks)
+			return err
+		}))
+	}
+	if *strictJson {
+		for i := range sources {
+			if sources[i].parse == nil {
+				sources[i].parse = parseStrictBookmarks
+			}
+		}
+	}
+	if *readRetries > 0 {
+		for i := range sources {
+			if sources[i].local {
+				sources[i].read = retryingRead(sources[i], *readRetries, *readRetryDelay)
+			}
+		}
+	}
+
+	if *watch {
+		if *interactive || *validate {
+			fatal(errors.New("--watch cannot be used with --interactive or --validate"))
+		}
+		watched := []bookmarksSource(nil)
+		for _, src := range sources {
+			if selectedProfiles.includes(src.profile) {
+				watched = append(watched, src)
+			}
+		}
+		w, err := newWatcher(watched, *watchInterval, *watchDebounce)
+		fatal(err)
+		runLog.discard() // every conversion run writes its own log entry
+		fatal(w.run())
+		return
+	}
+
+	if *interactive && isTerminal(os.Stdin) && isTerminal(os.Stdout) {
+		candidates, names, counts := []bookmarksSource(nil), []string(nil), []int(nil)
+		for _, src := range sources {
+			if !selectedProfiles.includes(src.profile) {
+				continue
+			}
+			b, err := src.load()
+			fatal(err)
+			candidates = append(candidates, src)
+			names = append(names, src.profile)
+			counts = append(counts, countBookmarks(b))
+		}
+		selected, err := selectProfiles(os.Stdin, os.Stderr, names, counts)
+		fatal(err)
+		sources = nil
+		for i, src := range candidates {
+			if selected[i] {
+				sources = append(sources, src)
+			}
+		}
+	}
+
+	if *validate {
+		// files that cannot be read or parsed take precedence over structural
+		// problems, which are reported with the generic exit code
+		code := 0
+		fail := func(c int) {
+			if code == 0 || code == exitGeneric {
+				code = c
+			}
+		}
+		for _, src := range sources {
+			if !selectedProfiles.includes(src.profile) {
+				continue
+			}
+			data, err := src.read()
+			if reportError(err) {
+				fail(exitCode(err))
+				continue
+			}
+			problems, err := validateBookmarks(data, src.path)
+			if reportError(err) {
+				fail(exitCode(err))
+				continue
+			}
+			for _, p := range problems {
+				reportError(fmt.Sprintf("bookmarks file %s: %s", src.path, p))
+				fail(exitGeneric)
+			}
+		}
+		runLog.write(code)
+		os.Exit(code)
+	}
+
+	cfg.profileTemplate, err = template.New("profile-name-template").Parse(*profileNameTemplate)
+	fatal(err)
+
+	if *templateFile != "" {
+		if !formatSet {
+			*format = "template"
+		}
+		cfg.template, err = parseTemplateFile(*templateFile, cfg)
+		fatal(err)
+	}
+
+	if *preview > 0 {
+		*output, *outputZip, *splitEvery = "", "", 0
+	}
+	outFormats, paths := []outputFormat(nil), []string(nil)
+	if *domainStatsFlag {
+		if *format != "markdown" && *format != "csv" {
+			fatal(fmt.Errorf("unsupported domain stats format %q, expected one of: markdown, csv", *format))
+		}
+	} else if *dedupeReport || *crossProfileDupes {
+		if *format != "markdown" && *format != "json" {
+			fatal(fmt.Errorf("unsupported dedupe report format %q, expected one of: markdown, json", *format))
+		}
+	} else {
+		outFormats, err = parseFormats(*format)
+		fatal(err)
+		if *outputZip != "" && len(outFormats) > 1 {
+			fatal(errors.New("--output-zip supports only a single format"))
+		}
+		if *preview > 0 && len(outFormats) > 1 {
+			fatal(errors.New("--preview supports only a single format"))
+		}
+		paths, err = outputPaths(outFormats, *output)
+		fatal(err)
+	}
+
+	if *splitEvery < 0 {
+		fatal(fmt.Errorf("split every must not be negative, got %d", *splitEvery))
+	}
+	if *splitEvery > 0 && *output == "" {
+		fatal(errors.New("--split-every requires --output to be a file path"))
+	}
+
+	loaded, malformedUrls, failed := []*profile(nil), 0, []error(nil)
+	for _, src := range sources {
+		if !selectedProfiles.includes(src.profile) {
+			continue
+		}
+		bookmarks, err := src.load()
+		if *keepGoing && err != nil {
+			reportError(fmt.Errorf("%s: %w", src.path, err))
+			failed = append(failed, err)
+			continue
+		}
+		fatal(err)
+		limitNesting(bookmarks, *maxNesting, src.path)
+		if *verifyChecksumFlag && *browser == "chrome" {
+			verifyChecksum(bookmarks, src.path)
+		}
+		indexEntries(bookmarks)
+		resolveUrlEntries(bookmarks, *urlByUrlField, src.path)
+		if *validateUrlsFlag {
+			malformedUrls += validateUrls(bookmarks, src.path)
+		}
+		if len(excludedGuids) > 0 {
+			pruneBookmarks(bookmarks, func(e *bookmarksEntry) bool { return excludedGuids[e.Guid] })
+		}
+		if !addedAfter.IsZero() {
+			pruneBookmarks(bookmarks, func(e *bookmarksEntry) bool {
+				t, ok := chromeTimeToTime(e.DateAdded)
+				return isUrlEntry(e) && (!ok || t.Before(addedAfter))
+			})
+		}
+		if !staleBefore.IsZero() {
+			pruneBookmarks(bookmarks, func(e *bookmarksEntry) bool { return isUrlEntry(e) && !isStale(e, staleBefore) })
+		}
+		if *normalizeHosts {
+			rewriteUrls(bookmarks, normalizeHost)
+		}
+		if *stripFragments || *stripQuery {
+			rewriteUrls(bookmarks, func(u string) string { return stripUrlParts(u, *stripFragments, *stripQuery) })
+		}
+		if *stripEmojiFlag {
+			walkBookmarks(bookmarks, func(e *bookmarksEntry, depth int) {
+				if depth > 0 {
+					e.Name = stripEmoji(e.Name)
+				}
+			})
+		}
+		if replacer != nil {
+			walkBookmarks(bookmarks, func(e *bookmarksEntry, depth int) {
+				if depth > 0 {
+					e.Name = replacer(e.Name)
+				}
+			})
+		}
+		if caser != nil {
+			walkBookmarks(bookmarks, func(e *bookmarksEntry, depth int) {
+				if depth > 0 {
+					e.Name = caser(e.Name)
+				}
+			})
+		}
+		sortBookmarks(bookmarks, urlsLess, foldersLess)
+		if *warnDups {
+			for _, r := range rootEntries(bookmarks) {
+				warnDuplicates(src.profile, r.Name, r.Children)
+			}
+		}
+		loaded = append(loaded, &profile{name: src.profile, source: src, bookmarks: bookmarks})
+	}
+	runLog.setProfiles(loaded)
+	if len(failed) > 0 {
+		// reported once the output of remaining files is complete
+		defer fatal(fmt.Errorf("%d bookmarks files could not be loaded: %w", len(failed), failed[0]))
+	}
+	if *warningsAsErrors && malformedUrls > 0 {
+		fatal(fmt.Errorf("found %d bookmarks with malformed URLs", malformedUrls))
+	}
+
+	if *expandShortUrls {
+		expander, err := newUrlExpander(strings.Split(*shortUrlHosts, ","), *expandConcurrency, *expandTimeout, shared)
+		fatal(err)
+		if failed := expander.run(loaded); failed > 0 {
+			reportWarning(fmt.Sprintf("expanding short URLs failed for %d bookmarks", failed))
+		}
+	}
+
+	if *mergeProfilesFlag && len(loaded) > 1 {
+		loaded = []*profile{mergeProfiles(loaded)}
+	}
+
+	if *dedupeReport || *crossProfileDupes || *domainStatsFlag {
+		if len(sources) == 0 {
+			fatal(&exitError{exitNoInput, fmt.Errorf("no bookmarks files found in %s", inputName)})
+		}
+		o, err := makeOutput(*output, cfg.outputMode)
+		fatal(err)
+		o, err = wrapOutput(o, cfg)
+		fatal(err)
+		if *redact || *redactNames {
+			for _, p := range loaded {
+				redactBookmarks(p.bookmarks, *redact, *redactNames)
+			}
+		}
+		if *domainStatsFlag {
+			fatal(writeDomainStats(o, domainStats(loaded, *dedupeStripWww), *format))
+		} else if *crossProfileDupes {
+			fatal(writeDedupeReport(o, "Bookmarks duplicated across profiles", crossProfileDuplicates(findDuplicates(loaded, *dedupeStripWww)), *format))
+		} else {
+			fatal(writeDedupeReport(o, "Duplicated bookmarks", findDuplicates(loaded, *dedupeStripWww), *format))
+		}
+		fatal(o.Sync())
+		fatal(o.Close())
+		return
+	}
+
+	if *dedupe {
+		for _, p := range loaded {
+			fatal(dedupeBookmarks(p.bookmarks, *dedupeKeep, *dedupeBy, *dedupeStripWww))
+		}
+	}
+
+	if *skipEmptyFolders || *onlyFolders {
+		for _, p := range loaded {
+			if *skipEmptyFolders {
+				pruneEmptyFolders(p.bookmarks)
+			}
+			if *onlyFolders {
+				pruneBookmarks(p.bookmarks, isUrlEntry)
+			}
+		}
+	}
+
+	if *combineRootsFlag && !*flat && *recent == 0 {
+		for _, p := range loaded {
+			p.bookmarks = combineRoots(p.bookmarks, *combineRootsMerge, p.name)
+		}
+	}
+
+	if *flat || *recent > 0 {
+		for _, p := range loaded {
+			prefix := []string(nil)
+			if *flatIncludeProfile {
+				prefix = []string{p.name}
+			}
+			if *recent > 0 {
+				p.bookmarks = recentBookmarks(p.bookmarks, *recent, prefix)
+			} else {
+				p.bookmarks = flattenBookmarks(p.bookmarks, prefix)
+			}
+		}
+	}
+
+	if *groupBy != "none" {
+		for _, p := range loaded {
+			if *groupBy == "tag" {
+				p.bookmarks = groupByTag(p.bookmarks, *tagsKey)
+				continue
+			}
+			if *groupBy == "date" {
+				p.bookmarks, err = groupByDate(p.bookmarks, *dateBucket)
+				fatal(err)
+				continue
+			}
+			p.bookmarks, err = groupByHost(p.bookmarks, *groupBy, *dedupeStripWww)
+			fatal(err)
+		}
+	}
+
+	if *alphaIndexFlag {
+		for _, p := range loaded {
+			p.bookmarks = alphaIndex(p.bookmarks)
+		}
+	}
+
+	if *execFlag != "" {
+		cmd, err := parseExecCommand(*execFlag, *execConcurrency, *execTimeout, *execAnnotate)
+		fatal(err)
+		cmd.shared = shared
+		if failed := cmd.run(loaded); failed > 0 {
+			reportWarning(fmt.Sprintf("exec failed for %d bookmarks", failed))
+		}
+	}
+
+	if *promoteBookmarkBar {
+		for _, p := range loaded {
+			p.bookmarks.barTop = p.bookmarks.Roots["bookmark_bar"] != nil
+		}
+	}
+
+	if *bannerStatsFlag {
+		cfg.bannerLines = append(cfg.bannerLines, bannerStats(loaded))
+	}
+	if *showVersionInBanner {
+		cfg.bannerLines = append(cfg.bannerLines, versionBanner())
+	}
+
+	if *maxChildren > 0 {
+		for _, p := range loaded {
+			if *summaryTree {
+				p.folders = folderTree(p.bookmarks)
+			}
+			capChildren(p.bookmarks, *maxChildren)
+		}
+	}
+
+	// redacted as the last step, so that all processing (like expanding short
+	// URLs and running --exec) sees original URLs and names
+	if *redact || *redactNames {
+		hostSections := *redact && (*groupBy == "domain" || *groupBy == "tld")
+		for _, p := range loaded {
+			redactBookmarks(p.bookmarks, *redact, *redactNames)
+			if p.folders != nil {
+				redactBookmarks(p.folders, *redact, *redactNames)
+			}
+			if hostSections {
+				// names of sections are hosts of redacted URLs
+				for _, r := range rootEntries(p.bookmarks) {
+					r.Name = shortHash(r.Name)
+				}
+			}
+		}
+	}
+
+	if *outputZip != "" {
+		if len(sources) == 0 {
+			fatal(&exitError{exitNoInput, fmt.Errorf("no bookmarks files found in %s", inputName)})
+		}
+		fatal(writeZipDocuments(*outputZip, outFormats[0], cfg, loaded))
+		return
+	}
+
+	if *splitEvery > 0 {
+		if len(sources) == 0 {
+			fatal(&exitError{exitNoInput, fmt.Errorf("no bookmarks files found in %s", inputName)})
+		}
+		fatal(writeSplitDocuments(outFormats, paths, cfg, loaded, *splitEvery))
+		return
+	}
+
+	outputs, err := makeOutputs(outFormats, paths, cfg)
+	fatal(err)
+	for _, o := range outputs {
+		defer o.w.Close()
+	}
+
+	if len(sources) == 0 {
+		fatal(&exitError{exitNoInput, fmt.Errorf("no bookmarks files found in %s", inputName)})
+	}
+
+	for _, o := range outputs {
+		fatal(writeDocument(o, loaded, "", cfg))
 	}
-	fatal(out.Sync())
 }
@@ -0,0 +1,3675 @@
+// Copyright 2022 Marek Dalewski
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+// testBookmarks is a small Chrome bookmarks file shared by tests.
+const testBookmarks = `{"version": 1, "roots": {
+	"bookmark_bar": {"name": "Bookmarks bar", "type": "folder", "children": [
+		{"name": "Go", "type": "url", "url": "https://go.dev/", "guid": "g1", "date_added": "13300000000000000"},
+		{"name": "Docs", "type": "folder", "guid": "g2", "children": [
+			{"name": "Effective Go", "type": "url", "url": "https://go.dev/doc/effective_go", "guid": "g3"}
+		]}
+	]},
+	"other": {"name": "Other bookmarks", "type": "folder", "children": [
+		{"name": "Example", "type": "url", "url": "https://www.example.com/a?x=1#top", "guid": "g4"}
+	]},
+	"synced": {"name": "Mobile bookmarks", "type": "folder", "children": []}
+}}`
+
+func mustParse(t *testing.T, data string) *bookmarks {
+	t.Helper()
+	b, err := parseBookmarks([]byte(data), "Bookmarks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func testProfile(t *testing.T, name, data string) *profile {
+	t.Helper()
+	return &profile{name: name, source: bookmarksSource{profile: name, path: name, origin: name}, bookmarks: mustParse(t, data)}
+}
+
+// treeString describes structure of the given entries, with children of every
+// folder listed in parentheses, like "Bar(Go Docs(Effective Go))".
+func treeString(entries []*bookmarksEntry) string {
+	res := []string(nil)
+	for _, e := range entries {
+		s := e.Name
+		if len(e.Children) != 0 {
+			s += "(" + treeString(e.Children) + ")"
+		}
+		res = append(res, s)
+	}
+	return strings.Join(res, " ")
+}
+
+func TestParseBookmarksVersions(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{
+			"version 1",
+			`{"version": 1, "roots": {"bookmark_bar": {"name": "Bar", "type": "folder", "children": [
+				{"name": "Go", "type": "url", "url": "https://go.dev/"}
+			]}}}`,
+			"Bar(Go)",
+		},
+		{
+			"version 2 children",
+			`{"version": 2, "roots": {"bookmark_bar": {"name": "Bar", "type": "folder", "children": [
+				{"name": "Docs", "type": "folder", "children": [{"name": "Go", "type": "url", "url": "https://go.dev/"}]}
+			]}}}`,
+			"Bar(Docs(Go))",
+		},
+		{
+			"version 2 nodes",
+			`{"version": 2, "roots": {"bookmark_bar": {"name": "Bar", "type": "folder", "nodes": [
+				{"name": "Docs", "type": "folder", "nodes": [{"name": "Go", "type": "url", "url": "https://go.dev/"}]}
+			]}}}`,
+			"Bar(Docs(Go))",
+		},
+		{
+			"version 2 children and nodes",
+			`{"version": 2, "roots": {"bookmark_bar": {"name": "Bar", "type": "folder",
+				"children": [{"name": "A", "type": "url", "url": "https://a.example/"}],
+				"nodes": [{"name": "B", "type": "url", "url": "https://b.example/"}]
+			}}}`,
+			"Bar(A B)",
+		},
+		{
+			"version 2 null entries",
+			`{"version": 2, "roots": {"bookmark_bar": {"name": "Bar", "type": "folder", "nodes": [null,
+				{"name": "Go", "type": "url", "url": "https://go.dev/"}
+			]}, "other": null}}`,
+			"Bar(Go)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := mustParse(t, tt.data)
+			if got := treeString(rootEntries(b)); got != tt.want {
+				t.Errorf("parseBookmarks() = %s, want %s", got, tt.want)
+			}
+			if u := b.Roots["bookmark_bar"]; u == nil || len(u.Children) == 0 {
+				t.Fatal("parseBookmarks() lost bookmark_bar content")
+			}
+		})
+	}
+}
+
+func TestParseBookmarksVersion2Fields(t *testing.T) {
+	b := mustParse(t, `{"version": 2, "checksum": "abc", "roots": {"other": {"name": "Other", "type": "folder", "nodes": [
+		{"name": "Go", "type": "url", "url": "https://go.dev/", "guid": "g1", "date_added": "13300000000000000", "meta_info": {"tags": "go"}}
+	]}}}`)
+	want := &bookmarksEntry{Name: "Go", Type: "url", Url: "https://go.dev/", Guid: "g1", DateAdded: "13300000000000000", MetaInfo: map[string]string{"tags": "go"}}
+	if b.Version != 2 || b.Checksum != "abc" {
+		t.Errorf("parseBookmarks() version %d and checksum %q, want 2 and abc", b.Version, b.Checksum)
+	}
+	if got := b.Roots["other"].Children[0]; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseBookmarks() entry = %+v, want %+v", got, want)
+	}
+}
+
+// renderProfile returns the given profile written by formatter of the given
+// format.
+func renderProfile(t *testing.T, format string, cfg *config, p *profile) string {
+	t.Helper()
+	f, err := findFormat(format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sb := &strings.Builder{}
+	if err := f.makeFormatter(cfg).writeProfile(sb, p); err != nil {
+		t.Fatal(err)
+	}
+	return sb.String()
+}
+
+func TestTreeFormatter(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{
+			"nested folders",
+			testBookmarks,
+			"Profile Default\n" +
+				"├── Bookmarks bar\n" +
+				"│   ├── Go (https://go.dev/)\n" +
+				"│   └── Docs\n" +
+				"│       └── Effective Go (https://go.dev/doc/effective_go)\n" +
+				"├── Other bookmarks\n" +
+				"│   └── Example (https://www.example.com/a?x=1#top)\n" +
+				"└── Mobile bookmarks\n" +
+				"\n",
+		},
+		{
+			"no roots",
+			`{"version": 1, "roots": {}}`,
+			"Profile Default\n\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderProfile(t, "tree", &config{}, testProfile(t, "Default", tt.data)); got != tt.want {
+				t.Errorf("writeProfile() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestZipSources(t *testing.T) {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for _, name := range []string{"Profile 1/Bookmarks", "Default/", "Default/Bookmarks", "Default/Preferences", "Bookmarks"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(name, "/") {
+			if _, err := io.WriteString(w, testBookmarks); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sources := zipSources("backup.zip", r)
+	wantProfiles := []string{"Default", "Profile 1", "backup"}
+	wantPaths := []string{"backup.zip:Default/Bookmarks", "backup.zip:Profile 1/Bookmarks", "backup.zip:Bookmarks"}
+	if len(sources) != len(wantProfiles) {
+		t.Fatalf("zipSources() returned %d sources, want %d", len(sources), len(wantProfiles))
+	}
+	for i, src := range sources {
+		if src.profile != wantProfiles[i] || src.path != wantPaths[i] {
+			t.Errorf("zipSources()[%d] = %s (%s), want %s (%s)", i, src.profile, src.path, wantProfiles[i], wantPaths[i])
+		}
+		b, err := src.load()
+		if err != nil {
+			t.Fatalf("load() error = %v", err)
+		}
+		if n := countBookmarks(b); n != 3 {
+			t.Errorf("load() found %d bookmarks, want 3", n)
+		}
+	}
+}
+
+func TestReadListFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"one per line", "Default\nProfile 1\n", []string{"Default", "Profile 1"}},
+		{"blank lines and comments", "# work\n\nDefault\n  # old\n\tProfile 2  \n", []string{"Default", "Profile 2"}},
+		{"windows line endings", "Default\r\nProfile 1\r\n", []string{"Default", "Profile 1"}},
+		{"empty", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "profiles.txt")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readListFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readListFile() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if _, err := readListFile(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("readListFile() of missing file succeeded")
+	}
+}
+
+func TestProfilesFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  *profilesFilter
+		names   []string
+		profile string
+		want    bool
+	}{
+		{"no names", &profilesFilter{}, nil, "Default", true},
+		{"listed", &profilesFilter{}, []string{"Default", " Profile 1 "}, "Profile 1", true},
+		{"not listed", &profilesFilter{}, []string{"Default"}, "Profile 1", false},
+		{"blank names ignored", &profilesFilter{}, []string{"", " "}, "Profile 1", true},
+		{"separators normalized", &profilesFilter{}, []string{"/backup/Default/"}, "backup/Default", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.filter.add(tt.names...)
+			if got := tt.filter.includes(tt.profile); got != tt.want {
+				t.Errorf("includes(%q) = %v, want %v", tt.profile, got, tt.want)
+			}
+		})
+	}
+}
+
+// captureStderr returns everything written to stderr while running fn.
+func captureStderr(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+	stderr := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = stderr }()
+	fn()
+	w.Close()
+	return <-out
+}
+
+// lines returns non empty lines of the given output.
+func lines(s string) []string {
+	res := []string(nil)
+	for _, l := range strings.Split(s, "\n") {
+		if l != "" {
+			res = append(res, l)
+		}
+	}
+	return res
+}
+
+func TestWarnDuplicates(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{"no duplicates", testBookmarks, nil},
+		{
+			"same folder",
+			`{"version": 1, "roots": {"bookmark_bar": {"name": "Bar", "type": "folder", "children": [
+				{"name": "Go", "type": "url", "url": "https://go.dev/"},
+				{"name": "Go", "type": "url", "url": "https://golang.org/"},
+				{"name": "Go", "type": "url", "url": "https://go.dev/doc/"}
+			]}}}`,
+			[]string{`Warning: profile Default: folder Bar: 3 bookmarks named "Go"`},
+		},
+		{
+			"different folders",
+			`{"version": 1, "roots": {"bookmark_bar": {"name": "Bar", "type": "folder", "children": [
+				{"name": "Go", "type": "url", "url": "https://go.dev/"},
+				{"name": "Go", "type": "folder", "children": [{"name": "Go", "type": "url", "url": "https://golang.org/"}]}
+			]}}}`,
+			nil,
+		},
+		{
+			"nested folder",
+			`{"version": 1, "roots": {"bookmark_bar": {"name": "Bar", "type": "folder", "children": [
+				{"name": "Docs", "type": "folder", "children": [
+					{"name": "Go", "type": "url", "url": "https://go.dev/"},
+					{"name": "Go", "type": "url", "url": "https://golang.org/"}
+				]}
+			]}}}`,
+			[]string{`Warning: profile Default: folder Bar/Docs: 2 bookmarks named "Go"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := mustParse(t, tt.data)
+			out := captureStderr(t, func() {
+				for _, r := range rootEntries(b) {
+					warnDuplicates("Default", r.Name, r.Children)
+				}
+			})
+			if got := lines(out); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("warnDuplicates() reported %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChromeTimeToTime(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   time.Time
+		wantOk bool
+	}{
+		{"13300000000000000", time.Date(2022, 6, 18, 4, 26, 40, 0, time.UTC), true},
+		{"11644473600000000", time.Unix(0, 0).UTC(), true},
+		{"", time.Time{}, false},
+		{"0", time.Time{}, false},
+		{"-5", time.Time{}, false},
+		{"soon", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := chromeTimeToTime(tt.value)
+		if ok != tt.wantOk || !got.Equal(tt.want) {
+			t.Errorf("chromeTimeToTime(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
+
+func TestShowDates(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry *bookmarksEntry
+		want  string
+	}{
+		{"bookmark", &bookmarksEntry{Type: "url", DateAdded: "13300000000000000"}, " (2022-06-18)"},
+		{"folder", &bookmarksEntry{Type: "folder", DateAdded: "13300000000000000"}, " (2022-06-18)"},
+		{"no date", &bookmarksEntry{Type: "folder"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (&config{showDates: true}).annotations(tt.entry); got != tt.want {
+				t.Errorf("annotations() = %q, want %q", got, tt.want)
+			}
+			if got := (&config{}).annotations(tt.entry); got != "" {
+				t.Errorf("annotations() without dates = %q, want none", got)
+			}
+		})
+	}
+}
+
+func TestOutputPaths(t *testing.T) {
+	tests := []struct {
+		name    string
+		formats string
+		path    string
+		want    []string
+		wantErr bool
+	}{
+		{"single format to stdout", "markdown", "", []string{""}, false},
+		{"single format keeps path", "html", "out.md", []string{"out.md"}, false},
+		{"extensions swapped", "markdown,html", "out/bookmarks.md", []string{"out/bookmarks.md", "out/bookmarks.html"}, false},
+		{"path without extension", "markdown,jsonl", "bookmarks", []string{"bookmarks.md", "bookmarks.jsonl"}, false},
+		{"multiple formats to stdout", "markdown,html", "", nil, true},
+		{"shared extension", "tree,urls", "out.txt", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			formats, err := parseFormats(tt.formats)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := outputPaths(formats, tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("outputPaths() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("outputPaths() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFormats(t *testing.T) {
+	tests := []struct {
+		list    string
+		want    []string
+		wantErr bool
+	}{
+		{"markdown", []string{"markdown"}, false},
+		{"markdown, html ,tree", []string{"markdown", "html", "tree"}, false},
+		{"markdown,pdf", nil, true},
+		{"", nil, true},
+	}
+	for _, tt := range tests {
+		formats, err := parseFormats(tt.list)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseFormats(%q) error = %v, wantErr %v", tt.list, err, tt.wantErr)
+			continue
+		}
+		got := []string(nil)
+		for _, f := range formats {
+			got = append(got, f.name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseFormats(%q) = %q, want %q", tt.list, got, tt.want)
+		}
+	}
+}
+
+func TestHeadingLevel(t *testing.T) {
+	tests := []struct {
+		base, level int
+		want        int
+		markdown    string
+	}{
+		{1, 0, 1, "#"},
+		{1, 1, 2, "##"},
+		{3, 1, 4, "####"},
+		{5, 2, 6, "######"},
+		{6, 1, 6, "######"},
+		{0, -1, 1, "#"},
+	}
+	for _, tt := range tests {
+		cfg := &config{baseHeadingLevel: tt.base}
+		if got := cfg.headingLevel(tt.level); got != tt.want {
+			t.Errorf("headingLevel(%d) with base %d = %d, want %d", tt.level, tt.base, got, tt.want)
+		}
+		if got := cfg.heading(tt.level); got != tt.markdown {
+			t.Errorf("heading(%d) with base %d = %q, want %q", tt.level, tt.base, got, tt.markdown)
+		}
+	}
+}
+
+func TestNbspIndent(t *testing.T) {
+	tests := []struct {
+		indent, nbsp string
+		want         string
+	}{
+		{"\t", "", "\t"},
+		{"  ", "entity", "&nbsp;&nbsp;"},
+		{"\t", "entity", "&nbsp;&nbsp;&nbsp;&nbsp;"},
+		{" \t", "unicode", strings.Repeat("\u00a0", 5)},
+	}
+	for _, tt := range tests {
+		f := &markdownFormatter{cfg: &config{indent: tt.indent, nbspIndent: tt.nbsp}}
+		if got := f.indent(); got != tt.want {
+			t.Errorf("indent() of %q with %q = %q, want %q", tt.indent, tt.nbsp, got, tt.want)
+		}
+	}
+}
+
+func TestValidateBookmarks(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{"valid", testBookmarks, nil},
+		{"missing roots", `{"version": 1}`, []string{"missing roots"}},
+		{
+			"unknown version and missing root",
+			`{"version": 7, "roots": {"bookmark_bar": {"type": "folder"}, "other": {"type": "folder"}}}`,
+			[]string{"unknown version 7", `missing root "synced"`},
+		},
+		{
+			"malformed entries",
+			`{"version": 1, "roots": {"bookmark_bar": {"type": "folder", "children": [
+				{"name": "Go", "type": "url"},
+				{"name": "Odd", "type": "url", "url": "https://odd.example/", "children": [{"name": "A", "type": "url", "url": "https://a.example/"}]},
+				{"name": "Docs", "type": "folder", "children": [{"name": "Ref", "type": "link"}]}
+			]}, "other": {"type": "folder"}, "synced": {"type": "folder"}}}`,
+			[]string{"bookmark_bar/Go: bookmark without url", "bookmark_bar/Odd: bookmark with children", `bookmark_bar/Docs/Ref: invalid entry type "link"`},
+		},
+		{
+			"null entries",
+			`{"version": 1, "roots": {"bookmark_bar": {"type": "folder", "children": [null]}, "other": {"type": "folder", "children": [
+				{"name": "Docs", "type": "folder", "children": [null]}
+			]}, "synced": null}}`,
+			[]string{`missing root "synced"`, "bookmark_bar: null entry", "other/Docs: null entry"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validateBookmarks([]byte(tt.data), "Bookmarks")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateBookmarks() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	_, err := validateBookmarks([]byte(`{"version": 1, "roots": `), "Bookmarks")
+	if err == nil || err.Error() != "bookmarks file Bookmarks: unexpected end of JSON input" {
+		t.Errorf("validateBookmarks() error = %v, want unexpected end of JSON input", err)
+	}
+	if code := exitCode(err); code != exitParse {
+		t.Errorf("exitCode(%v) = %d, want %d", err, code, exitParse)
+	}
+}
+
+func TestWalkBookmarksSkipsNullEntries(t *testing.T) {
+	b := mustParse(t, `{"version": 1, "roots": {"other": {"name": "Other", "type": "folder", "children": [null,
+		{"name": "Docs", "type": "folder", "children": [null, {"name": "Go", "type": "url", "url": "https://go.dev/"}]}
+	]}}}`)
+	got := []string(nil)
+	walkBookmarks(b, func(e *bookmarksEntry, depth int) {
+		got = append(got, fmt.Sprintf("%d:%s", depth, e.Name))
+	})
+	if want := []string{"0:Other", "1:Docs", "2:Go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("walkBookmarks() visited %q, want %q", got, want)
+	}
+}
+
+func TestPruneBookmarksByGuid(t *testing.T) {
+	tests := []struct {
+		name  string
+		guids []string
+		want  string
+	}{
+		{"nothing excluded", nil, "Bookmarks bar(Go Docs(Effective Go)) Other bookmarks(Example) Mobile bookmarks"},
+		{"bookmark", []string{"g1"}, "Bookmarks bar(Docs(Effective Go)) Other bookmarks(Example) Mobile bookmarks"},
+		{"folder with content", []string{"g2"}, "Bookmarks bar(Go) Other bookmarks(Example) Mobile bookmarks"},
+		{"many", []string{"g3", "g4", "missing"}, "Bookmarks bar(Go Docs) Other bookmarks Mobile bookmarks"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			excluded := map[string]bool{}
+			for _, g := range tt.guids {
+				excluded[g] = true
+			}
+			b := mustParse(t, testBookmarks)
+			pruneBookmarks(b, func(e *bookmarksEntry) bool { return excluded[e.Guid] })
+			if got := treeString(rootEntries(b)); got != tt.want {
+				t.Errorf("pruneBookmarks() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHostBadges(t *testing.T) {
+	tests := []struct {
+		name   string
+		badges bool
+		url    string
+		want   string
+	}{
+		{"badge", true, "https://Go.dev:443/doc", `<li><a href="https://Go.dev:443/doc">Go</a> <span class="host">Go.dev</span></li>` + "\n"},
+		{"no host", true, "javascript:void(0)", `<li><a href="javascript:void(0)">Go</a></li>` + "\n"},
+		{"disabled", false, "https://go.dev/", `<li><a href="https://go.dev/">Go</a></li>` + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &htmlFormatter{cfg: &config{hostBadges: tt.badges}}
+			sb := &strings.Builder{}
+			if err := f.writeEntry(sb, &bookmarksEntry{Name: "Go", Type: "url", Url: tt.url}, ""); err != nil {
+				t.Fatal(err)
+			}
+			if got := sb.String(); got != tt.want {
+				t.Errorf("writeEntry() = %q, want %q", got, tt.want)
+			}
+			sb.Reset()
+			if err := f.writeHeader(sb); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Contains(sb.String(), hostBadgesStyle); got != tt.badges {
+				t.Errorf("writeHeader() includes badges style = %v, want %v", got, tt.badges)
+			}
+		})
+	}
+}
+
+func TestSortEntries(t *testing.T) {
+	const data = `{"version": 1, "roots": {"other": {"name": "Other", "type": "folder", "children": [
+		{"name": "c", "type": "url", "url": "https://c.example/", "date_added": "13300000000000002"},
+		{"name": "Zeta", "type": "folder", "date_added": "13300000000000001"},
+		{"name": "a", "type": "url", "url": "https://a.example/"},
+		{"name": "Alpha", "type": "folder", "date_added": "13300000000000003", "children": [
+			{"name": "y", "type": "url", "url": "https://y.example/"},
+			{"name": "x", "type": "url", "url": "https://x.example/"}
+		]},
+		{"name": "B", "type": "url", "url": "https://b.example/", "date_added": "13300000000000001"}
+	]}}}`
+	tests := []struct {
+		name          string
+		urls, folders string
+		want          string
+	}{
+		{"none", "none", "none", "Other(c Zeta a Alpha(y x) B)"},
+		{"bookmarks by name", "name", "none", "Other(a Zeta B Alpha(x y) c)"},
+		{"folders by name", "none", "name", "Other(c Alpha(y x) a Zeta B)"},
+		{"both by name", "name", "name", "Other(a Alpha(x y) B Zeta c)"},
+		{"bookmarks by date", "date", "none", "Other(B Zeta c Alpha(y x) a)"},
+		{"folders by date", "none", "date", "Other(c Zeta a Alpha(y x) B)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			urlsLess, err := entriesComparator(tt.urls, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			foldersLess, err := entriesComparator(tt.folders, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := mustParse(t, data)
+			sortBookmarks(b, urlsLess, foldersLess)
+			if got := treeString(rootEntries(b)); got != tt.want {
+				t.Errorf("sortBookmarks() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+	if _, err := entriesComparator("size", false); err == nil {
+		t.Error("entriesComparator() accepted unknown order")
+	}
+}
+
+func TestSplitProfiles(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+		want []string
+	}{
+		{"one part", 3, []string{"Bookmarks bar(Go Docs(Effective Go)) Other bookmarks(Example) Mobile bookmarks"}},
+		{
+			"folder repeated across parts", 1,
+			[]string{"Bookmarks bar(Go)", "Bookmarks bar(Docs(Effective Go))", "Other bookmarks(Example) Mobile bookmarks"},
+		},
+		{"uneven parts", 2, []string{"Bookmarks bar(Go Docs(Effective Go))", "Other bookmarks(Example) Mobile bookmarks"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string(nil)
+			for _, part := range splitProfiles([]*profile{testProfile(t, "Default", testBookmarks)}, tt.n) {
+				if len(part) != 1 || part[0].name != "Default" {
+					t.Fatalf("splitProfiles() part has %d profiles, want only Default", len(part))
+				}
+				got = append(got, treeString(rootEntries(part[0].bookmarks)))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitProfiles() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitNote(t *testing.T) {
+	tests := []struct {
+		part, total int
+		want        string
+	}{
+		{1, 1, "Part 1 of 1."},
+		{1, 3, "Part 1 of 3. Continued in out-002.md."},
+		{2, 3, "Part 2 of 3. Continued from out-001.md. Continued in out-003.md."},
+		{3, 3, "Part 3 of 3. Continued from out-002.md."},
+	}
+	for _, tt := range tests {
+		if got := splitNote(filepath.Join("docs", "out.md"), tt.part, tt.total); got != tt.want {
+			t.Errorf("splitNote(%d, %d) = %q, want %q", tt.part, tt.total, got, tt.want)
+		}
+	}
+	if got, want := splitOutputPath("out.md", 12), "out-012.md"; got != want {
+		t.Errorf("splitOutputPath() = %q, want %q", got, want)
+	}
+}
+
+// writeFiles creates files with the given slash separated paths under dir,
+// all holding testBookmarks.
+func writeFiles(t *testing.T, dir string, paths ...string) {
+	t.Helper()
+	for _, p := range paths {
+		p = filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(testBookmarks), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func sourceProfiles(sources []bookmarksSource) []string {
+	res := []string(nil)
+	for _, s := range sources {
+		res = append(res, filepath.ToSlash(s.profile))
+	}
+	return res
+}
+
+func TestFollowSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "real/Default/Bookmarks", "scan/Profile 1/Bookmarks")
+	scan := filepath.Join(dir, "scan")
+	if err := os.Symlink(filepath.Join(dir, "real"), filepath.Join(scan, "link")); err != nil {
+		t.Skipf("symbolic links not supported: %v", err)
+	}
+	if err := os.Symlink(scan, filepath.Join(scan, "Profile 1", "loop")); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		follow bool
+		want   []string
+	}{
+		{false, []string{"Profile 1"}},
+		{true, []string{"Profile 1", "link/Default"}},
+	}
+	for _, tt := range tests {
+		sources, err := findDirectorySources(scan, 25, tt.follow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := sourceProfiles(sources); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("findDirectorySources() following symlinks %v = %q, want %q", tt.follow, got, tt.want)
+		}
+	}
+}
+
+func TestMaxScanDepth(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "Bookmarks", "Default/Bookmarks", "a/b/Bookmarks", "a/b/c/d/Bookmarks")
+	tests := []struct {
+		depth int
+		want  []string
+	}{
+		{0, []string{"Bookmarks"}},
+		{1, []string{"Bookmarks", "Default/Bookmarks"}},
+		{2, []string{"Bookmarks", "Default/Bookmarks", "a/b/Bookmarks"}},
+		{4, []string{"Bookmarks", "Default/Bookmarks", "a/b/Bookmarks", "a/b/c/d/Bookmarks"}},
+	}
+	for _, tt := range tests {
+		files, err := findAllBookmarksFiles(dir, tt.depth, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string(nil)
+		for _, f := range files {
+			rel, err := filepath.Rel(dir, f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, filepath.ToSlash(rel))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("findAllBookmarksFiles() with depth %d = %q, want %q", tt.depth, got, tt.want)
+		}
+	}
+}
+
+func TestShowSourcePath(t *testing.T) {
+	tests := []struct {
+		format string
+		show   bool
+		want   string
+	}{
+		{"markdown", true, "## Profile Default\n<!-- source: /home/user/Default/Bookmarks -->\n"},
+		{"markdown", false, "## Profile Default\n- Bookmarks bar\n"},
+		{"html", true, "<h2>Profile Default</h2>\n<!-- source: /home/user/Default/Bookmarks -->\n"},
+		{"html", false, "<h2>Profile Default</h2>\n<ul>\n"},
+	}
+	for _, tt := range tests {
+		p := testProfile(t, "Default", testBookmarks)
+		p.source.origin = "/home/user/Default/Bookmarks"
+		cfg := &config{indent: "\t", baseHeadingLevel: 1, showSourcePath: tt.show}
+		if got := renderProfile(t, tt.format, cfg, p); !strings.HasPrefix(got, tt.want) {
+			t.Errorf("%s writeProfile() with source path %v =\n%s\nwant prefix\n%s", tt.format, tt.show, got, tt.want)
+		}
+	}
+}
+
+func TestMergeProfiles(t *testing.T) {
+	a := testProfile(t, "A", `{"version": 1, "roots": {"bookmark_bar": {"name": "Bar", "type": "folder", "children": [
+		{"name": "Docs", "type": "folder", "children": [{"name": "x", "type": "url", "url": "https://x.example/"}]},
+		{"name": "Only A", "type": "folder"}
+	]}}}`)
+	b := testProfile(t, "B", `{"version": 1, "roots": {
+		"bookmark_bar": {"name": "Bar", "type": "folder", "children": [
+			{"name": "Docs", "type": "folder", "children": [{"name": "y", "type": "url", "url": "https://y.example/"}]},
+			{"name": "z", "type": "url", "url": "https://z.example/"}
+		]},
+		"other": {"name": "Other", "type": "folder", "children": [{"name": "w", "type": "url", "url": "https://w.example/"}]}
+	}}`)
+	m := mergeProfiles([]*profile{a, b})
+	if m.name != "A, B" || m.source.origin != "A, B" {
+		t.Errorf("mergeProfiles() named %q from %q, want A, B", m.name, m.source.origin)
+	}
+	if got, want := treeString(rootEntries(m.bookmarks)), "Bar(Docs(x y) Only A z) Other(w)"; got != want {
+		t.Errorf("mergeProfiles() = %s, want %s", got, want)
+	}
+
+	cfg := &config{mergeMarkers: true}
+	bar := m.bookmarks.Roots["bookmark_bar"]
+	tests := []struct {
+		entry *bookmarksEntry
+		want  []string
+	}{
+		{bar, []string{"merged from: A, B"}},
+		{bar.Children[0], []string{"merged from: A, B"}},
+		{bar.Children[1], nil},
+		{m.bookmarks.Roots["other"], nil},
+	}
+	for _, tt := range tests {
+		if got := cfg.comments(tt.entry); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("comments(%s) = %q, want %q", tt.entry.Name, got, tt.want)
+		}
+		if got := (&config{}).comments(tt.entry); got != nil {
+			t.Errorf("comments(%s) without markers = %q, want none", tt.entry.Name, got)
+		}
+	}
+}
+
+func TestRedactBookmarks(t *testing.T) {
+	tests := []struct {
+		name        string
+		urls, names bool
+		want        []string // name and URL of bookmarks bar entries
+	}{
+		{"nothing", false, false, []string{"Bookmarks bar", "Go https://go.dev/", "Docs", "Effective Go https://go.dev/doc/effective_go"}},
+		{"URLs", true, false, []string{"Bookmarks bar", "Go ba6e07bb", "Docs", "Effective Go 5d82dc9a"}},
+		{"names", false, true, []string{"Bookmarks bar", "6cc8519b https://go.dev/", "7af023c4", "0d98056f https://go.dev/doc/effective_go"}},
+		{"both", true, true, []string{"Bookmarks bar", "6cc8519b ba6e07bb", "7af023c4", "0d98056f 5d82dc9a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := mustParse(t, testBookmarks)
+			redactBookmarks(b, tt.urls, tt.names)
+			got := []string(nil)
+			walkEntry(b.Roots["bookmark_bar"], 0, func(e *bookmarksEntry, depth int) {
+				got = append(got, strings.TrimSpace(e.Name+" "+e.Url))
+			})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("redactBookmarks() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlphaIndex(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"letters", testBookmarks, "E(Effective Go Example) G(Go)"},
+		{
+			"case and non letters",
+			`{"version": 1, "roots": {"other": {"name": "Other", "type": "folder", "children": [
+				{"name": "beta", "type": "url", "url": "https://b.example/"},
+				{"name": "42", "type": "url", "url": "https://n.example/"},
+				{"name": "Ärger", "type": "url", "url": "https://ae.example/"},
+				{"name": "Alpha", "type": "url", "url": "https://a.example/"},
+				{"name": "_private", "type": "url", "url": "https://p.example/"},
+				{"name": "Box", "type": "folder", "children": [{"name": "apple", "type": "url", "url": "https://ap.example/"}]}
+			]}}}`,
+			"A(Alpha apple) B(beta) Ä(Ärger) #(42 _private)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := alphaIndex(mustParse(t, tt.data))
+			if !b.sections {
+				t.Error("alphaIndex() groups are not sections")
+			}
+			if got := treeString(rootEntries(b)); got != tt.want {
+				t.Errorf("alphaIndex() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// testHelpers lists functions run instead of tests when the test binary is
+// started with CBM_TEST_HELPER environment variable set to their name.
+var testHelpers = map[string]func(){"main": main}
+
+func TestMain(m *testing.M) {
+	if h := testHelpers[os.Getenv("CBM_TEST_HELPER")]; h != nil {
+		h()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runMain runs the program with the given arguments in a separate process and
+// returns its stdout, stderr and exit code.
+func runMain(t *testing.T, args ...string) (string, string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "CBM_TEST_HELPER=main")
+	stdout, stderr := &strings.Builder{}, &strings.Builder{}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		t.Fatal(err)
+	}
+	return stdout.String(), stderr.String(), cmd.ProcessState.ExitCode()
+}
+
+func TestExitCode(t *testing.T) {
+	_, pathErr := os.Open(filepath.Join(t.TempDir(), "missing"))
+	syntaxErr := json.Unmarshal([]byte("{"), &struct{}{})
+	typeErr := json.Unmarshal([]byte(`{"version": "1"}`), &bookmarks{})
+	tests := []struct {
+		name string
+		err  interface{}
+		want int
+	}{
+		{"exit error", &exitError{exitNoInput, errors.New("no input")}, exitNoInput},
+		{"wrapped exit error", fmt.Errorf("loading: %w", &exitError{exitIO, errors.New("download failed")}), exitIO},
+		{"JSON syntax", syntaxErr, exitParse},
+		{"JSON type", fmt.Errorf("bookmarks file: %w", typeErr), exitParse},
+		{"zip format", zip.ErrFormat, exitParse},
+		{"missing file", pathErr, exitIO},
+		{"truncated read", io.ErrUnexpectedEOF, exitIO},
+		{"other error", errors.New("invalid flag"), exitGeneric},
+		{"message", "invalid flag", exitGeneric},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.err); got != tt.want {
+				t.Errorf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMainExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "valid/Default/Bookmarks")
+	if err := os.MkdirAll(filepath.Join(dir, "broken", "Default"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "broken", "Default", "Bookmarks"), []byte(`{"version": 1, "roots": `), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "invalid", "Default"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "invalid", "Default", "Bookmarks"), []byte(`{"version": 1, "roots": {"other": {"type": "folder"}}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "empty"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"success", []string{"-input", filepath.Join(dir, "valid")}, 0},
+		{"invalid flag value", []string{"-input", filepath.Join(dir, "valid"), "-sort", "size"}, exitGeneric},
+		{"no bookmarks files", []string{"-input", filepath.Join(dir, "empty")}, exitNoInput},
+		{"malformed bookmarks file", []string{"-input", filepath.Join(dir, "broken")}, exitParse},
+		{"output not writable", []string{"-input", filepath.Join(dir, "valid"), "-output", filepath.Join(dir, "missing", "out.md")}, exitIO},
+		{"validate malformed bookmarks file", []string{"-input", filepath.Join(dir, "broken"), "-validate"}, exitParse},
+		{"validate invalid structure", []string{"-input", filepath.Join(dir, "invalid"), "-validate"}, exitGeneric},
+		{"validate safari bookmarks", []string{"-browser", "safari", "-input", filepath.Join(dir, "valid", "Default", "Bookmarks"), "-validate"}, exitGeneric},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, code := runMain(t, tt.args...)
+			if code != tt.want {
+				t.Errorf("exit code = %d, want %d, stderr:\n%s", code, tt.want, stderr)
+			}
+			if tt.want == 0 && !strings.Contains(stdout, "## Profile Default\n") {
+				t.Errorf("output misses profile:\n%s", stdout)
+			}
+		})
+	}
+}
+
+// bufferOutput is an in-memory WriteSyncCloser counting Sync and Close calls.
+type bufferOutput struct {
+	bytes.Buffer
+	syncs, closes int
+}
+
+func (b *bufferOutput) Sync() error  { b.syncs++; return nil }
+func (b *bufferOutput) Close() error { b.closes++; return nil }
+
+// renderDocument returns the given profiles written by writeDocument in the
+// given format.
+func renderDocument(t *testing.T, format string, cfg *config, profiles ...*profile) string {
+	t.Helper()
+	f, err := findFormat(format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &bufferOutput{}
+	if err := writeDocument(outputTarget{f.makeFormatter(cfg), out}, profiles, "", cfg); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestTemplateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc.tmpl")
+	tmpl := `{{range .Profiles}}# {{escape .Name}}
+{{template "entries" .Entries}}{{end}}
+{{- define "entries"}}{{range .}}{{indent .Depth}}{{if .IsFolder}}{{.Name}}
+{{template "entries" .Children}}{{else}}{{.Name}} ({{host .Url}}{{if not .DateAdded.IsZero}}, {{.DateAdded.UTC.Year}}{{end}})
+{{end}}{{end}}{{end}}`
+	if err := os.WriteFile(path, []byte(tmpl), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config{indent: "  "}
+	var err error
+	if cfg.template, err = parseTemplateFile(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+	want := "# my\\_profile\n" +
+		"Bookmarks bar\n" +
+		"  Go (go.dev, 2022)\n" +
+		"  Docs\n" +
+		"    Effective Go (go.dev)\n" +
+		"Other bookmarks\n" +
+		"  Example (www.example.com)\n" +
+		"Mobile bookmarks\n"
+	if got := renderDocument(t, "template", cfg, testProfile(t, "my_profile", testBookmarks)); got != want {
+		t.Errorf("template output = %q, want %q", got, want)
+	}
+}
+
+func TestTemplateFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "broken.tmpl")
+	if err := os.WriteFile(path, []byte("{{range .Profiles}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{path, filepath.Join(dir, "missing.tmpl")} {
+		if _, err := parseTemplateFile(p, &config{}); err == nil {
+			t.Errorf("parseTemplateFile(%s) succeeded", filepath.Base(p))
+		}
+	}
+	f, _ := findFormat("template")
+	err := writeDocument(outputTarget{f.makeFormatter(&config{}), &bufferOutput{}}, nil, "", &config{})
+	if err == nil {
+		t.Error("template format without template succeeded")
+	}
+}
+
+func TestFlattenBookmarks(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix []string
+		want   string
+	}{
+		{"without prefix", nil, "- [Go](https://go.dev/)\n- Docs / [Effective Go](https://go.dev/doc/effective_go)\n- [Example](https://www.example.com/a?x=1#top)\n\n"},
+		{"with profile", []string{"Default"}, "- Default / [Go](https://go.dev/)\n- Default / Docs / [Effective Go](https://go.dev/doc/effective_go)\n- Default / [Example](https://www.example.com/a?x=1#top)\n\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := testProfile(t, "Default", testBookmarks)
+			p.bookmarks = flattenBookmarks(p.bookmarks, tt.prefix)
+			got := renderProfile(t, "markdown", &config{indent: "\t", baseHeadingLevel: 1}, p)
+			if got = strings.TrimPrefix(got, "## Profile Default\n"); got != tt.want {
+				t.Errorf("flat output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUrlSource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/backup/Default/Bookmarks" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, testBookmarks)
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	s, err := urlSource(srv.URL+"/backup/Default/Bookmarks", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := host + "/backup/Default"; s.profile != want {
+		t.Errorf("urlSource() profile = %q, want %q", s.profile, want)
+	}
+	b, err := s.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := treeString(rootEntries(b)), treeString(rootEntries(mustParse(t, testBookmarks))); got != want {
+		t.Errorf("urlSource() bookmarks = %s, want %s", got, want)
+	}
+
+	s, err = urlSource(srv.URL+"/missing", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.load(); exitCode(err) != exitIO {
+		t.Errorf("urlSource() error = %v, want exit code %d", err, exitIO)
+	}
+}
+
+func TestIsUrlInput(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"https://example.com/Bookmarks", true},
+		{"http://example.com/Bookmarks", true},
+		{"ftp://example.com/Bookmarks", false},
+		{"Bookmarks", false},
+		{"-", false},
+		{filepath.Join("http:", "Bookmarks"), false},
+	}
+	for _, tt := range tests {
+		if got := isUrlInput(tt.input); got != tt.want {
+			t.Errorf("isUrlInput(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+// dupBookmarks has the same URL bookmarked at different depths.
+const dupBookmarks = `{"version": 1, "roots": {
+	"bookmark_bar": {"name": "Bar", "type": "folder", "children": [
+		{"name": "A1", "type": "url", "url": "https://a.example/"},
+		{"name": "F", "type": "folder", "children": [
+			{"name": "A2", "type": "url", "url": "https://a.example/"},
+			{"name": "S", "type": "folder", "children": [
+				{"name": "A3", "type": "url", "url": " https://a.example/ "},
+				{"name": "B", "type": "url", "url": "https://b.example/"}
+			]}
+		]}
+	]},
+	"other": {"name": "Other", "type": "folder", "children": [
+		{"name": "A4", "type": "url", "url": "https://a.example/"}
+	]}
+}}`
+
+func TestDedupeBookmarks(t *testing.T) {
+	tests := []struct {
+		strategy string
+		want     string
+	}{
+		{"first", "Bar(A1 F(S(B))) Other"},
+		{"last", "Bar(F(S(B))) Other(A4)"},
+		{"shallowest", "Bar(A1 F(S(B))) Other"},
+		{"deepest", "Bar(F(S(A3 B))) Other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			b := mustParse(t, dupBookmarks)
+			if err := dedupeBookmarks(b, tt.strategy, "url", false); err != nil {
+				t.Fatal(err)
+			}
+			if got := treeString(rootEntries(b)); got != tt.want {
+				t.Errorf("dedupeBookmarks() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+	if err := dedupeBookmarks(mustParse(t, dupBookmarks), "random", "url", false); err == nil {
+		t.Error("dedupeBookmarks() succeeded for unknown strategy")
+	}
+}
+
+// specialBookmarks has names and URL with characters special in markup
+// formats.
+const specialBookmarks = `{"version": 1, "roots": {"other": {"name": "A*b", "type": "folder", "children": [
+	{"name": "x_[y]` + "`" + `z", "type": "url", "url": "https://e.example/a[1] b"}
+]}}}`
+
+// testFormatter checks output of the given format for testBookmarks and
+// specialBookmarks.
+func testFormatter(t *testing.T, format, want, wantSpecial string) {
+	t.Helper()
+	cfg := &config{indent: "\t", baseHeadingLevel: 1}
+	if got := renderProfile(t, format, cfg, testProfile(t, "Default", testBookmarks)); got != want {
+		t.Errorf("%s output = %q, want %q", format, got, want)
+	}
+	if got := renderProfile(t, format, cfg, testProfile(t, "Default", specialBookmarks)); got != wantSpecial {
+		t.Errorf("%s output with special characters = %q, want %q", format, got, wantSpecial)
+	}
+}
+
+func TestRstFormatter(t *testing.T) {
+	testFormatter(t, "rst",
+		"Profile Default\n---------------\n\n"+
+			"- Bookmarks bar\n\n"+
+			"  - `Go <https://go.dev/>`__\n"+
+			"  - Docs\n\n"+
+			"    - `Effective Go <https://go.dev/doc/effective_go>`__\n\n\n"+
+			"- Other bookmarks\n\n"+
+			"  - `Example <https://www.example.com/a?x=1#top>`__\n\n"+
+			"- Mobile bookmarks\n\n",
+		"Profile Default\n---------------\n\n- A\\*b\n\n  - `x\\_[y]\\`z <https://e.example/a[1] b>`__\n\n\n",
+	)
+}
+
+func TestAsciidocFormatter(t *testing.T) {
+	testFormatter(t, "asciidoc",
+		"== Profile Default\n\n"+
+			"* Bookmarks bar\n"+
+			"** link:https://go.dev/[Go]\n"+
+			"** Docs\n"+
+			"*** link:https://go.dev/doc/effective_go[Effective Go]\n"+
+			"* Other bookmarks\n"+
+			"** link:https://www.example.com/a?x=1#top[Example]\n"+
+			"* Mobile bookmarks\n\n",
+		"== Profile Default\n\n* A\\*b\n** link:https://e.example/a%5B1%5D%20b[x\\_\\[y\\]\\`z]\n\n",
+	)
+}
+
+func TestOrgFormatter(t *testing.T) {
+	testFormatter(t, "org",
+		"* Profile Default\n"+
+			"** Bookmarks bar\n"+
+			"- [[https://go.dev/][Go]]\n"+
+			"*** Docs\n"+
+			"- [[https://go.dev/doc/effective_go][Effective Go]]\n"+
+			"** Other bookmarks\n"+
+			"- [[https://www.example.com/a?x=1#top][Example]]\n"+
+			"** Mobile bookmarks\n",
+		"* Profile Default\n** A*b\n- [[https://e.example/a\\[1\\] b][x_{y}`z]]\n",
+	)
+}
+
+func TestSelectProfiles(t *testing.T) {
+	names, counts := []string{"Default", "Profile 1", "Work"}, []int{3, 1, 0}
+	tests := []struct {
+		name    string
+		input   string
+		want    []bool
+		invalid []string
+	}{
+		{"accept all", "\n", []bool{true, true, true}, nil},
+		{"end of input", "", []bool{true, true, true}, nil},
+		{"toggle", "2\n\n", []bool{true, false, true}, nil},
+		{"toggle twice", "2, 3\n3\n\n", []bool{true, false, true}, nil},
+		{"none and toggle", "n\n1 3\n", []bool{true, false, true}, nil},
+		{"none and all", "n\na\n\n", []bool{true, true, true}, nil},
+		{"invalid numbers", "0 x 4 1\n\n", []bool{false, true, true}, []string{`"0"`, `"x"`, `"4"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &strings.Builder{}
+			got, err := selectProfiles(strings.NewReader(tt.input), out, names, counts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectProfiles() = %v, want %v", got, tt.want)
+			}
+			if !strings.Contains(out.String(), "  2. [x] Profile 1 (1 bookmarks)\n") {
+				t.Errorf("selectProfiles() prompt = %q", out.String())
+			}
+			for _, n := range tt.invalid {
+				if !strings.Contains(out.String(), "Invalid profile number "+n+"\n") {
+					t.Errorf("selectProfiles() did not report invalid number %s", n)
+				}
+			}
+		})
+	}
+}
+
+func TestProfilesFilterPrefix(t *testing.T) {
+	tests := []struct {
+		profile string
+		want    bool
+	}{
+		{"Profile 1", true},
+		{"Profile 12", true},
+		{"backup/Default", true},
+		{"back", false},
+		{"Default", false},
+		{"Work", true},
+	}
+	filter := &profilesFilter{prefix: true}
+	filter.add("Profile", "backup/", "Work")
+	for _, tt := range tests {
+		if got := filter.includes(tt.profile); got != tt.want {
+			t.Errorf("includes(%q) = %v, want %v", tt.profile, got, tt.want)
+		}
+	}
+}
+
+func TestLimitedWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  int64
+		writes []string
+		want   string
+	}{
+		{"under limit", 100, []string{"abc\n", "de", "f\n"}, "abc\ndef\n"},
+		{"exact limit", 8, []string{"abc\n", "def\n"}, "abc\ndef\n"},
+		{"truncated at line", 6, []string{"abc\ndef\n", "ghi\n"}, "abc\n\n[output truncated after 4 bytes]\n"},
+		{"line split across writes", 6, []string{"ab", "c", "\nde", "fgh\n"}, "abc\n\n[output truncated after 4 bytes]\n"},
+		{"first line too long", 2, []string{"abc\n"}, "\n[output truncated after 0 bytes]\n"},
+		{"incomplete last line", 100, []string{"abc\nde"}, "abc\nde"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bufferOutput{}
+			w := &limitedWriter{WriteSyncCloser: out, limit: tt.limit}
+			for _, s := range tt.writes {
+				if n, err := io.WriteString(w, s); err != nil || n != len(s) {
+					t.Fatalf("Write(%q) = %d, %v", s, n, err)
+				}
+			}
+			if err := w.Sync(); err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("limitedWriter wrote %q, want %q", got, tt.want)
+			}
+			if out.syncs != 1 {
+				t.Errorf("limitedWriter synced %d times, want 1", out.syncs)
+			}
+		})
+	}
+}
+
+func TestFormatThousands(t *testing.T) {
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{0, "0"},
+		{999, "999"},
+		{1000, "1,000"},
+		{123456, "123,456"},
+		{1234567, "1,234,567"},
+		{-1234, "-1,234"},
+		{-123, "-123"},
+	}
+	for _, tt := range tests {
+		if got := formatThousands(tt.n); got != tt.want {
+			t.Errorf("formatThousands(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestBannerStats(t *testing.T) {
+	single := `{"version": 1, "roots": {"other": {"name": "Other", "type": "folder", "children": [
+		{"name": "Go", "type": "url", "url": "https://go.dev/"}
+	]}}}`
+	tests := []struct {
+		name     string
+		profiles []*profile
+		want     string
+	}{
+		{"none", nil, "0 bookmarks across 0 profiles."},
+		{"single", []*profile{testProfile(t, "A", single)}, "1 bookmark across 1 profile."},
+		{"many", []*profile{testProfile(t, "A", testBookmarks), testProfile(t, "B", single)}, "4 bookmarks across 2 profiles."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bannerStats(tt.profiles); got != tt.want {
+				t.Errorf("bannerStats() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeHost(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"HTTPS://Go.DEV/Doc/Effective_Go?Q=A#Top", "https://go.dev/Doc/Effective_Go?Q=A#Top"},
+		{"http://EXAMPLE.com:8080/", "http://example.com:8080/"},
+		{"https://go.dev/", "https://go.dev/"},
+		{"MAILTO:Someone@Example.com", "MAILTO:Someone@Example.com"},
+		{"javascript:alert(1)", "javascript:alert(1)"},
+		{"http://[::1%zone/", "http://[::1%zone/"},
+	}
+	for _, tt := range tests {
+		if got := normalizeHost(tt.url); got != tt.want {
+			t.Errorf("normalizeHost(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestStripUrlParts(t *testing.T) {
+	tests := []struct {
+		url             string
+		fragment, query bool
+		want            string
+	}{
+		{"https://www.example.com/a?x=1#top", true, false, "https://www.example.com/a?x=1"},
+		{"https://www.example.com/a?x=1#top", false, true, "https://www.example.com/a#top"},
+		{"https://www.example.com/a?x=1#top", true, true, "https://www.example.com/a"},
+		{"https://www.example.com/a?x=1#top", false, false, "https://www.example.com/a?x=1#top"},
+		{"https://www.example.com/a?#", true, true, "https://www.example.com/a"},
+		{"https://www.example.com/a#%2Fpath", true, false, "https://www.example.com/a"},
+		{"http://[::1%zone/?x#y", true, true, "http://[::1%zone/?x#y"},
+	}
+	for _, tt := range tests {
+		if got := stripUrlParts(tt.url, tt.fragment, tt.query); got != tt.want {
+			t.Errorf("stripUrlParts(%q, %v, %v) = %q, want %q", tt.url, tt.fragment, tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestReferenceLinks(t *testing.T) {
+	f, err := findFormat("markdown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mf := f.makeFormatter(&config{indent: "\t", baseHeadingLevel: 1, referenceLinks: true})
+	sb := &strings.Builder{}
+	for _, p := range []*profile{testProfile(t, "A", testBookmarks), testProfile(t, "B", specialBookmarks)} {
+		if err := mf.writeProfile(sb, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := "## Profile A\n" +
+		"- Bookmarks bar\n" +
+		"\t- [Go][1]\n" +
+		"\t- Docs\n" +
+		"\t\t- [Effective Go][2]\n" +
+		"- Other bookmarks\n" +
+		"\t- [Example][3]\n" +
+		"- Mobile bookmarks\n\n" +
+		"[1]: https://go.dev/\n" +
+		"[2]: https://go.dev/doc/effective_go\n" +
+		"[3]: https://www.example.com/a?x=1#top\n\n" +
+		"## Profile B\n" +
+		"- A\\*b\n" +
+		"\t- [x\\_\\[y\\]\\`z][4]\n\n" +
+		"[4]: <https://e.example/a[1] b>\n\n"
+	if got := sb.String(); got != want {
+		t.Errorf("reference links output = %q, want %q", got, want)
+	}
+}
+
+func TestGlobSources(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "work.json", "home.json", "notes.txt", "sub.json/Bookmarks")
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"*.json", []string{"home", "work"}},
+		{"*", []string{"home", "notes", "work"}},
+		{"h*.json", []string{"home"}},
+		{"*.yaml", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			sources, err := globSources(filepath.Join(dir, tt.pattern))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, s := range sources {
+				got = append(got, s.profile)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("globSources() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if _, err := globSources(filepath.Join(dir, "[")); err == nil {
+		t.Error("globSources() succeeded for malformed pattern")
+	}
+}
+
+func TestResolveUrlEntries(t *testing.T) {
+	data := `{"version": 1, "roots": {"other": {"name": "Other", "type": "folder", "children": [
+		{"name": "Go", "type": "url", "url": "https://go.dev/"},
+		{"name": "Typeless", "url": "https://example.com/"},
+		{"name": "Both", "type": "folder", "url": "https://both.example/", "children": [
+			{"name": "Child", "type": "url", "url": "https://child.example/"}
+		]}
+	]}}}`
+	tests := []struct {
+		byUrlField bool
+		want       []bool
+	}{
+		{false, []bool{true, false, false}},
+		{true, []bool{true, true, true}},
+	}
+	for _, tt := range tests {
+		b := mustParse(t, data)
+		warnings := captureStderr(t, func() { resolveUrlEntries(b, tt.byUrlField, "Bookmarks") })
+		got := []bool{}
+		for _, e := range b.Roots["other"].Children {
+			got = append(got, isUrlEntry(e))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("resolveUrlEntries(%v) bookmarks = %v, want %v", tt.byUrlField, got, tt.want)
+		}
+		want := []string{`Warning: bookmarks file Bookmarks: entry "Both" of type "folder" has both URL and children`}
+		if got := lines(warnings); !reflect.DeepEqual(got, want) {
+			t.Errorf("resolveUrlEntries(%v) reported %q, want %q", tt.byUrlField, got, want)
+		}
+	}
+}
+
+func TestUrlsWithPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		withPath bool
+		flat     bool
+		want     string
+	}{
+		{"plain", false, false, "https://go.dev/\nhttps://go.dev/doc/effective_go\nhttps://www.example.com/a?x=1#top\n"},
+		{"with path", true, false, "\thttps://go.dev/\nDocs\thttps://go.dev/doc/effective_go\n\thttps://www.example.com/a?x=1#top\n"},
+		{"flat with profile", true, true, "Default\thttps://go.dev/\nDefault/Docs\thttps://go.dev/doc/effective_go\nDefault\thttps://www.example.com/a?x=1#top\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := testProfile(t, "Default", testBookmarks)
+			if tt.flat {
+				p.bookmarks = flattenBookmarks(p.bookmarks, []string{"Default"})
+			}
+			if got := renderProfile(t, "urls", &config{urlsWithPath: tt.withPath}, p); got != tt.want {
+				t.Errorf("urls output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSitemapFormatter(t *testing.T) {
+	data := `{"version": 1, "roots": {"other": {"name": "Other", "type": "folder", "children": [
+		{"name": "Go", "type": "url", "url": "https://go.dev/", "date_added": "13300000000000000"},
+		{"name": "Query", "type": "url", "url": "http://example.com/?a=1&b=<2>"},
+		{"name": "FTP", "type": "url", "url": "ftp://example.com/file"},
+		{"name": "Script", "type": "url", "url": "javascript:void(0)"}
+	]}}}`
+	type sitemap struct {
+		XMLName xml.Name
+		Urls    []struct {
+			Loc     string `xml:"loc"`
+			Lastmod string `xml:"lastmod"`
+		} `xml:"url"`
+	}
+	tests := []struct {
+		name      string
+		showDates bool
+		lastmod   string
+	}{
+		{"without dates", false, ""},
+		{"with dates", true, "2022-06-18"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := renderDocument(t, "sitemap", &config{showDates: tt.showDates}, testProfile(t, "Default", data))
+			s := sitemap{}
+			if err := xml.Unmarshal([]byte(out), &s); err != nil {
+				t.Fatalf("sitemap is not valid XML: %v\n%s", err, out)
+			}
+			if s.XMLName.Space != "http://www.sitemaps.org/schemas/sitemap/0.9" || s.XMLName.Local != "urlset" {
+				t.Errorf("sitemap root element = %v, want sitemap urlset", s.XMLName)
+			}
+			if len(s.Urls) != 2 {
+				t.Fatalf("sitemap has %d urls, want 2\n%s", len(s.Urls), out)
+			}
+			if s.Urls[0].Loc != "https://go.dev/" || s.Urls[0].Lastmod != tt.lastmod {
+				t.Errorf("sitemap first url = %+v, want https://go.dev/ with lastmod %q", s.Urls[0], tt.lastmod)
+			}
+			if s.Urls[1].Loc != "http://example.com/?a=1&b=<2>" || s.Urls[1].Lastmod != "" {
+				t.Errorf("sitemap second url = %+v", s.Urls[1])
+			}
+		})
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	groups := findDuplicates([]*profile{testProfile(t, "A", dupBookmarks), testProfile(t, "B", testBookmarks), testProfile(t, "C", dupBookmarks)}, false)
+	if len(groups) != 2 || groups[1].Url != "https://b.example/" || len(groups[1].Occurrences) != 2 {
+		t.Fatalf("findDuplicates() returned %d groups, want a.example and b.example", len(groups))
+	}
+	out := &strings.Builder{}
+	if err := writeDedupeReport(out, "Duplicated bookmarks", groups[:1], "markdown"); err != nil {
+		t.Fatal(err)
+	}
+	want := "# Duplicated bookmarks\n\n" +
+		"## https://a.example/\n\n" +
+		"- Profile A: Bar / A1\n" +
+		"- Profile A: Bar / F / A2\n" +
+		"- Profile A: Bar / F / S / A3\n" +
+		"- Profile A: Other / A4\n" +
+		"- Profile C: Bar / A1\n" +
+		"- Profile C: Bar / F / A2\n" +
+		"- Profile C: Bar / F / S / A3\n" +
+		"- Profile C: Other / A4\n\n"
+	if got := out.String(); got != want {
+		t.Errorf("writeDedupeReport() = %q, want %q", got, want)
+	}
+}
+
+func TestWriteDedupeReport(t *testing.T) {
+	groups := findDuplicates([]*profile{testProfile(t, "A", dupBookmarks)}, false)
+	tests := []struct {
+		name   string
+		groups []*duplicateGroup
+		format string
+		want   string
+	}{
+		{"markdown without duplicates", nil, "markdown", "# Report\n\nNo duplicated bookmarks found.\n"},
+		{"json without duplicates", nil, "json", "[]\n"},
+		{"json", groups, "json", `[
+  {
+    "url": "https://a.example/",
+    "occurrences": [
+      {
+        "profile": "A",
+        "path": [
+          "Bar"
+        ],
+        "name": "A1"
+      },
+      {
+        "profile": "A",
+        "path": [
+          "Bar",
+          "F"
+        ],
+        "name": "A2"
+      },
+      {
+        "profile": "A",
+        "path": [
+          "Bar",
+          "F",
+          "S"
+        ],
+        "name": "A3"
+      },
+      {
+        "profile": "A",
+        "path": [
+          "Other"
+        ],
+        "name": "A4"
+      }
+    ]
+  }
+]
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &strings.Builder{}
+			if err := writeDedupeReport(out, "Report", tt.groups, tt.format); err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("writeDedupeReport() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// nested returns chain of folders with the given depth, with a bookmark in the
+// innermost one.
+func nested(depth int) *bookmarksEntry {
+	e := &bookmarksEntry{Name: "Go", Type: "url", Url: "https://go.dev/"}
+	for i := depth; i > 0; i-- {
+		e = &bookmarksEntry{Name: fmt.Sprintf("F%d", i), Type: "folder", Children: []*bookmarksEntry{e}}
+	}
+	return e
+}
+
+// depth returns the number of levels of entries below the given one.
+func depth(e *bookmarksEntry) int {
+	res := 0
+	for _, c := range e.Children {
+		if d := depth(c) + 1; d > res {
+			res = d
+		}
+	}
+	return res
+}
+
+func TestLimitNesting(t *testing.T) {
+	tests := []struct {
+		name      string
+		depth     int
+		limit     int
+		wantDepth int
+		errors    []string
+	}{
+		{"shallow", 3, 5, 4, nil},
+		{"at limit", 4, 5, 5, nil},
+		{"too deep", 5, 3, 3, []string{`Error: bookmarks file Bookmarks: folder "F3" is nested deeper than 3 levels, its content has been skipped`}},
+		{"extremely deep", 100000, 1000, 1000, []string{`Error: bookmarks file Bookmarks: folder "F1000" is nested deeper than 1000 levels, its content has been skipped`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := &bookmarksEntry{Name: "Other", Type: "folder", Children: []*bookmarksEntry{nested(tt.depth)}}
+			b := &bookmarks{Roots: map[string]*bookmarksEntry{"other": root}}
+			errors := captureStderr(t, func() { limitNesting(b, tt.limit, "Bookmarks") })
+			if got := depth(root); got != tt.wantDepth {
+				t.Errorf("limitNesting() left %d levels, want %d", got, tt.wantDepth)
+			}
+			if got := lines(errors); !reflect.DeepEqual(got, tt.errors) {
+				t.Errorf("limitNesting() reported %q, want %q", got, tt.errors)
+			}
+		})
+	}
+}
+
+func TestOrderIndex(t *testing.T) {
+	data := `{"version": 1, "roots": {"other": {"name": "Other", "type": "folder", "children": [
+		{"name": "Zeta", "type": "url", "url": "https://z.example/"},
+		{"name": "Alpha", "type": "url", "url": "https://a.example/"},
+		{"name": "Docs", "type": "folder", "children": [
+			{"name": "Mu", "type": "url", "url": "https://m.example/"}
+		]}
+	]}}}`
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"markdown", "## Profile Default\n- Other\n\t2. [Alpha](https://a.example/)\n\t1. [Zeta](https://z.example/)\n\t3. Docs\n\t\t1. [Mu](https://m.example/)\n\n"},
+		{"tree", "Profile Default\n└── Other\n    ├── 2. Alpha (https://a.example/)\n    ├── 1. Zeta (https://z.example/)\n    └── 3. Docs\n        └── 1. Mu (https://m.example/)\n\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			p := testProfile(t, "Default", data)
+			indexEntries(p.bookmarks)
+			less, err := entriesComparator("name", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sortBookmarks(p.bookmarks, less, less)
+			if got := renderProfile(t, tt.format, &config{indent: "\t", baseHeadingLevel: 1, orderIndex: true}, p); got != tt.want {
+				t.Errorf("%s output = %q, want %q", tt.format, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlushingWriter(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval int
+		writes   []string
+		syncs    int
+	}{
+		{"every line", 1, []string{"a\n", "b\n", "c\n"}, 3},
+		{"every two lines", 2, []string{"a\n", "b\n", "c\n", "d\n", "e\n"}, 2},
+		{"only at line boundary", 2, []string{"a\nb", "c", "\n", "d\n"}, 1},
+		{"many lines in a write", 2, []string{"a\nb\nc\n", "d\n"}, 1},
+		{"below interval", 10, []string{"a\n", "b\n"}, 0},
+		{"without new lines", 1, []string{"a", "b"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bufferOutput{}
+			w := &flushingWriter{WriteSyncCloser: out, interval: tt.interval}
+			for _, s := range tt.writes {
+				if _, err := io.WriteString(w, s); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if out.syncs != tt.syncs {
+				t.Errorf("flushingWriter synced %d times, want %d", out.syncs, tt.syncs)
+			}
+			if got, want := out.String(), strings.Join(tt.writes, ""); got != want {
+				t.Errorf("flushingWriter wrote %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestRecentBookmarks(t *testing.T) {
+	data := `{"version": 1, "roots": {
+		"bookmark_bar": {"name": "Bar", "type": "folder", "children": [
+			{"name": "Old", "type": "url", "url": "https://old.example/", "date_added": "13200000000000000"},
+			{"name": "Undated", "type": "url", "url": "https://undated.example/"},
+			{"name": "Docs", "type": "folder", "children": [
+				{"name": "New", "type": "url", "url": "https://new.example/", "date_added": "13300000000000000"}
+			]}
+		]},
+		"other": {"name": "Other", "type": "folder", "children": [
+			{"name": "Middle", "type": "url", "url": "https://middle.example/", "date_added": "13250000000000000"}
+		]}
+	}}`
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{1, "New"},
+		{3, "New Middle Old"},
+		{10, "New Middle Old Undated"},
+	}
+	for _, tt := range tests {
+		b := recentBookmarks(mustParse(t, data), tt.n, nil)
+		if got := treeString(topEntries(b)); got != tt.want {
+			t.Errorf("recentBookmarks(%d) = %s, want %s", tt.n, got, tt.want)
+		}
+	}
+	b := recentBookmarks(mustParse(t, data), 1, []string{"Default"})
+	if got := b.Roots["flat"].Children[0].breadcrumb; !reflect.DeepEqual(got, []string{"Default", "Docs"}) {
+		t.Errorf("recentBookmarks() breadcrumb = %q, want [Default Docs]", got)
+	}
+}
+
+func TestProfileTitle(t *testing.T) {
+	tests := []struct {
+		template string
+		want     string
+		wantErr  bool
+	}{
+		{"", "Profile Default", false},
+		{"Profile {{.Name}}", "Profile Default", false},
+		{"{{.Browser}}: {{.Name}} ({{.Count}} bookmarks)", "chrome: Default (3 bookmarks)", false},
+		{"{{.Path}}", "/home/user/Default", false},
+		{"{{.Missing}}", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			cfg := &config{browser: "chrome"}
+			if tt.template != "" {
+				cfg.profileTemplate = template.Must(template.New("profile-name-template").Parse(tt.template))
+			}
+			p := testProfile(t, "Default", testBookmarks)
+			p.source.origin = "/home/user/Default"
+			got, err := cfg.profileTitle(p)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("profileTitle() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("profileTitle() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCapChildren(t *testing.T) {
+	tests := []struct {
+		n       int
+		want    string
+		omitted []int // omitted children of Bar and Other
+	}{
+		{1, "Bar(A1) Other(A4)", []int{1, 0}},
+		{2, "Bar(A1 F(A2 S(A3 B))) Other(A4)", []int{0, 0}},
+		{0, "Bar Other", []int{2, 1}},
+	}
+	for _, tt := range tests {
+		b := mustParse(t, dupBookmarks)
+		capChildren(b, tt.n)
+		if got := treeString(rootEntries(b)); got != tt.want {
+			t.Errorf("capChildren(%d) = %s, want %s", tt.n, got, tt.want)
+		}
+		if got := []int{b.Roots["bookmark_bar"].omitted, b.Roots["other"].omitted}; !reflect.DeepEqual(got, tt.omitted) {
+			t.Errorf("capChildren(%d) omitted = %v, want %v", tt.n, got, tt.omitted)
+		}
+	}
+}
+
+func TestCapChildrenOutput(t *testing.T) {
+	capped := func(flat bool, n int) *profile {
+		p := testProfile(t, "Default", dupBookmarks)
+		if flat {
+			p.bookmarks = flattenBookmarks(p.bookmarks, nil)
+		}
+		capChildren(p.bookmarks, n)
+		return p
+	}
+	tests := []struct {
+		format string
+		flat   bool
+		want   string
+	}{
+		{"markdown", false, "## Profile Default\n- Bar\n\t- [A1](https://a.example/)\n\t- … and 1 more\n- Other\n\t- [A4](https://a.example/)\n\n"},
+		{"markdown", true, "## Profile Default\n- [A1](https://a.example/)\n- F / [A2](https://a.example/)\n- … and 3 more\n\n"},
+		{"tree", false, "Profile Default\n├── Bar\n│   ├── A1 (https://a.example/)\n│   └── … and 1 more\n└── Other\n    └── A4 (https://a.example/)\n\n"},
+		{"tree", true, "Profile Default\n├── A1 (https://a.example/)\n├── F / A2 (https://a.example/)\n└── … and 3 more\n\n"},
+	}
+	for _, tt := range tests {
+		n := 1
+		if tt.flat {
+			n = 2
+		}
+		if got := renderProfile(t, tt.format, &config{indent: "\t", baseHeadingLevel: 1}, capped(tt.flat, n)); got != tt.want {
+			t.Errorf("%s output (flat %v) = %q, want %q", tt.format, tt.flat, got, tt.want)
+		}
+	}
+	// other formats list the kept entries only
+	for _, format := range []string{"json-tree", "jsonl", "urls", "sitemap", "html"} {
+		got := renderProfile(t, format, &config{indent: "\t", baseHeadingLevel: 1}, capped(false, 1))
+		if strings.Contains(got, "more") || strings.Count(got, "https://a.example/") != 2 {
+			t.Errorf("%s output = %q, want only the two kept bookmarks", format, got)
+		}
+	}
+}
+
+func TestMarkdownEscape(t *testing.T) {
+	tests := []struct {
+		flavor string
+		text   string
+		want   string
+	}{
+		{"gfm", "# a_b _c_ ~x| 2^3 $5 @me", "\\# a_b \\_c\\_ \\~x\\| 2^3 $5 @me"},
+		{"commonmark", "# a_b _c_ ~x| 2^3 $5 @me", "\\# a_b \\_c\\_ ~x| 2^3 $5 @me"},
+		{"pandoc", "# a_b _c_ ~x| 2^3 $5 @me", "\\# a_b \\_c\\_ \\~x| 2\\^3 \\$5 \\@me"},
+		{"gfm", "> [x](y) `z` *w* <b> c:\\d", "\\> \\[x\\](y) \\`z\\` \\*w\\* \\<b> c:\\\\d"},
+		{"gfm", "a #1 > b", "a #1 > b"},
+		{"gfm", "snake_case_name zażółć_gęślą", "snake_case_name zażółć_gęślą"},
+	}
+	for _, tt := range tests {
+		f := &markdownFormatter{cfg: &config{markdownFlavor: tt.flavor}}
+		if got := f.escape(tt.text); got != tt.want {
+			t.Errorf("escape(%q) with %s flavor = %q, want %q", tt.text, tt.flavor, got, tt.want)
+		}
+	}
+}
+
+func TestMarkdownLinkDestination(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://go.dev/", "https://go.dev/"},
+		{"https://e.example/a b", "<https://e.example/a b>"},
+		{"https://en.wikipedia.org/wiki/Go_(language)", "<https://en.wikipedia.org/wiki/Go_(language)>"},
+		{"https://e.example/<x>", "<https://e.example/%3Cx%3E>"},
+	}
+	for _, tt := range tests {
+		if got := markdownLinkDestination(tt.url); got != tt.want {
+			t.Errorf("markdownLinkDestination(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestSortCaseSensitive(t *testing.T) {
+	data := `{"version": 1, "roots": {"other": {"name": "Other", "type": "folder", "children": [
+		{"name": "b", "type": "url", "url": "https://b.example/"},
+		{"name": "B", "type": "url", "url": "https://b.example/"},
+		{"name": "a", "type": "url", "url": "https://a.example/"},
+		{"name": "A", "type": "url", "url": "https://a.example/"}
+	]}}}`
+	tests := []struct {
+		caseSensitive bool
+		want          string
+	}{
+		{false, "Other(a A b B)"},
+		{true, "Other(A B a b)"},
+	}
+	for _, tt := range tests {
+		less, err := entriesComparator("name", tt.caseSensitive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := mustParse(t, data)
+		sortBookmarks(b, less, nil)
+		if got := treeString(rootEntries(b)); got != tt.want {
+			t.Errorf("sortBookmarks() case sensitive %v = %s, want %s", tt.caseSensitive, got, tt.want)
+		}
+	}
+}
+
+func TestFindDirectorySourcesFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "Work/Bookmarks", "backup.json", "Home/Default/Bookmarks")
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"Work/Bookmarks", []string{"Work"}},
+		{"backup.json", []string{"backup"}},
+		{"Home", []string{"Default"}},
+		{"Home/Default/Bookmarks", []string{"Default"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			sources, err := findDirectorySources(filepath.Join(dir, filepath.FromSlash(tt.path)), 5, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := sourceProfiles(sources); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findDirectorySources() profiles = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromoteBookmarkBar(t *testing.T) {
+	p := testProfile(t, "Default", testBookmarks)
+	p.bookmarks.barTop = true
+	want := "## Profile Default\n" +
+		"- [Go](https://go.dev/)\n" +
+		"- Docs\n" +
+		"\t- [Effective Go](https://go.dev/doc/effective_go)\n" +
+		"- Other bookmarks\n" +
+		"\t- [Example](https://www.example.com/a?x=1#top)\n" +
+		"- Mobile bookmarks\n\n"
+	if got := renderProfile(t, "markdown", &config{indent: "\t", baseHeadingLevel: 1}, p); got != want {
+		t.Errorf("markdown output = %q, want %q", got, want)
+	}
+	p.bookmarks = flattenBookmarks(p.bookmarks, nil)
+	p.bookmarks.barTop = true
+	if got := treeString(topEntries(p.bookmarks)); got != "Go Effective Go Example" {
+		t.Errorf("topEntries() of flat bookmarks = %s, want Go Effective Go Example", got)
+	}
+}
+
+func TestJsonlFormatter(t *testing.T) {
+	p := testProfile(t, "Default", testBookmarks)
+	want := []jsonlEntry{
+		{"Default", []string{"Bookmarks bar"}, "Go", "https://go.dev/"},
+		{"Default", []string{"Bookmarks bar", "Docs"}, "Effective Go", "https://go.dev/doc/effective_go"},
+		{"Default", []string{"Other bookmarks"}, "Example", "https://www.example.com/a?x=1#top"},
+	}
+	out := renderProfile(t, "jsonl", &config{}, p)
+	got := []jsonlEntry{}
+	for _, l := range strings.SplitAfter(out, "\n") {
+		if l == "" {
+			continue
+		}
+		e := jsonlEntry{}
+		if err := json.Unmarshal([]byte(l), &e); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", l, err)
+		}
+		got = append(got, e)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("jsonl output = %+v, want %+v", got, want)
+	}
+	if wantLine := `{"profile":"Default","path":["Other bookmarks"],"name":"Example","url":"https://www.example.com/a?x=1#top"}` + "\n"; !strings.HasSuffix(out, wantLine) {
+		t.Errorf("jsonl output = %q, want last line %q", out, wantLine)
+	}
+}
+
+func TestDedupeByTitle(t *testing.T) {
+	data := `{"version": 1, "roots": {"other": {"name": "Other", "type": "folder", "children": [
+		{"name": "Go", "type": "url", "url": "https://go.dev/?utm_source=newsletter"},
+		{"name": " go ", "type": "url", "url": "https://go.dev/"},
+		{"name": "Rust", "type": "url", "url": "https://go.dev/"},
+		{"name": "GO", "type": "url", "url": "https://golang.org/"}
+	]}}}`
+	tests := []struct {
+		strategy string
+		want     string
+	}{
+		{"first", "Other(Go Rust)"},
+		{"last", "Other(Rust GO)"},
+	}
+	for _, tt := range tests {
+		b := mustParse(t, data)
+		if err := dedupeBookmarks(b, tt.strategy, "title", false); err != nil {
+			t.Fatal(err)
+		}
+		if got := treeString(rootEntries(b)); got != tt.want {
+			t.Errorf("dedupeBookmarks(%s, title) = %s, want %s", tt.strategy, got, tt.want)
+		}
+	}
+	if err := dedupeBookmarks(mustParse(t, data), "first", "host", false); err == nil {
+		t.Error("dedupeBookmarks() succeeded for unknown key")
+	}
+}
+
+func TestWrap(t *testing.T) {
+	data := `{"version": 1, "roots": {"other": {"name": "one two three four five six seven", "type": "folder", "children": [
+		{"name": "Go programming language", "type": "url", "url": "https://go.dev/"},
+		{"name": "Go", "type": "url", "url": "https://go.dev/"}
+	]}}}`
+	tests := []struct {
+		name string
+		wrap int
+		want string
+	}{
+		{"disabled", 0, "## Profile Default\n- one two three four five six seven\n\t- [Go programming language](https://go.dev/)\n\t- [Go](https://go.dev/)\n\n"},
+		{"links kept whole", 20, "## Profile Default\n- one two three four\n  five six seven\n\t- [Go programming language](https://go.dev/)\n\t- [Go](https://go.dev/)\n\n"},
+		{"narrow", 8, "## Profile Default\n- one\n  two\n  three\n  four\n  five\n  six\n  seven\n\t- [Go programming language](https://go.dev/)\n\t- [Go](https://go.dev/)\n\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := renderProfile(t, "markdown", &config{indent: "\t", baseHeadingLevel: 1, wrap: tt.wrap}, testProfile(t, "Default", data))
+			if got != tt.want {
+				t.Errorf("markdown output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitWrapWords(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"a  b", []string{"a", "b"}},
+		{"[Go programming](https://go.dev/) (2022-06-18)", []string{"[Go programming](https://go.dev/)", "(2022-06-18)"}},
+		{"[a [b] c](<d e>) f", []string{"[a [b] c](<d e>)", "f"}},
+		{"[Go (lang)](https://en.wikipedia.org/wiki/Go_(language)) x", []string{"[Go (lang)](https://en.wikipedia.org/wiki/Go_(language))", "x"}},
+		{"\\[a b\\] c", []string{"\\[a", "b\\]", "c"}},
+		{"[h] (i j)", []string{"[h]", "(i", "j)"}},
+	}
+	for _, tt := range tests {
+		if got := splitWrapWords(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitWrapWords(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestFolderTree(t *testing.T) {
+	b := mustParse(t, testBookmarks)
+	if got, want := treeString(rootEntries(folderTree(b))), "Bookmarks bar(Docs) Other bookmarks Mobile bookmarks"; got != want {
+		t.Errorf("folderTree() = %s, want %s", got, want)
+	}
+	if got, want := treeString(rootEntries(b)), "Bookmarks bar(Go Docs(Effective Go)) Other bookmarks(Example) Mobile bookmarks"; got != want {
+		t.Errorf("folderTree() modified bookmarks to %s", got)
+	}
+}
+
+func TestPruneEmptyFolders(t *testing.T) {
+	data := `{"version": 1, "roots": {"other": {"name": "Other", "type": "folder", "children": [
+		{"name": "Empty", "type": "folder", "children": []},
+		{"name": "Nested", "type": "folder", "children": [{"name": "Empty", "type": "folder", "children": []}]},
+		{"name": "Full", "type": "folder", "children": [
+			{"name": "Empty", "type": "folder"},
+			{"name": "Go", "type": "url", "url": "https://go.dev/"}
+		]}
+	]}, "synced": {"name": "Mobile", "type": "folder", "children": []}}}`
+	b := mustParse(t, data)
+	pruneEmptyFolders(b)
+	if got, want := treeString(rootEntries(b)), "Other(Full(Go)) Mobile"; got != want {
+		t.Errorf("pruneEmptyFolders() = %s, want %s", got, want)
+	}
+}
+
+func TestAutolinks(t *testing.T) {
+	cfg := &config{indent: "\t", baseHeadingLevel: 1, autolinks: true}
+	want := "## Profile Default\n- Bookmarks bar\n\t- <https://go.dev/>\n\t- Docs\n\t\t- <https://go.dev/doc/effective_go>\n- Other bookmarks\n\t- <https://www.example.com/a?x=1#top>\n- Mobile bookmarks\n\n"
+	if got := renderProfile(t, "markdown", cfg, testProfile(t, "Default", testBookmarks)); got != want {
+		t.Errorf("markdown output = %q, want %q", got, want)
+	}
+	want = "## Profile Default\n- A\\*b\n\t- <https://e.example/a[1]%20b>\n\n"
+	if got := renderProfile(t, "markdown", cfg, testProfile(t, "Default", specialBookmarks)); got != want {
+		t.Errorf("markdown output = %q, want %q", got, want)
+	}
+}
+
+func TestCrossProfileDuplicates(t *testing.T) {
+	single := func(url string) string {
+		return `{"version": 1, "roots": {"other": {"name": "Other", "type": "folder", "children": [
+			{"name": "X", "type": "url", "url": "` + url + `"}
+		]}}}`
+	}
+	groups := findDuplicates([]*profile{
+		testProfile(t, "A", dupBookmarks),
+		testProfile(t, "B", single("https://b.example/")),
+		testProfile(t, "C", single("https://go.dev/")),
+	}, false)
+	got := []string{}
+	for _, g := range crossProfileDuplicates(groups) {
+		got = append(got, g.Url)
+	}
+	if want := []string{"https://b.example/"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("crossProfileDuplicates() = %q, want %q", got, want)
+	}
+}
+
+func TestConfluenceFormatter(t *testing.T) {
+	data := `{"version": 1, "roots": {"other": {"name": "R&D <team>", "type": "folder", "children": [
+		{"name": "Q&A \"faq\"", "type": "url", "url": "https://e.example/?a=1&b=2"},
+		{"name": "Empty", "type": "folder", "children": []}
+	]}}}`
+	want := "<h1>Chrome bookmarks</h1>\n" +
+		"<p>This document was automatically generated by <a href=\"https://github.com/daishe/chrome-bookmarks-to-markdown\">chrome-bookmarks-to-markdown</a>.</p>\n" +
+		"<h2>Profile Default</h2>\n" +
+		"<ul>\n" +
+		"\t<li>R&amp;D &lt;team&gt;\n" +
+		"\t\t<ul>\n" +
+		"\t\t\t<li><a href=\"https://e.example/?a=1&amp;b=2\">Q&amp;A &#34;faq&#34;</a></li>\n" +
+		"\t\t\t<li>Empty</li>\n" +
+		"\t\t</ul>\n" +
+		"\t</li>\n" +
+		"</ul>\n"
+	got := renderDocument(t, "confluence", &config{indent: "\t", baseHeadingLevel: 1}, testProfile(t, "Default", data))
+	if got != want {
+		t.Errorf("confluence output = %q, want %q", got, want)
+	}
+	d := xml.NewDecoder(strings.NewReader("<root>" + got + "</root>"))
+	for {
+		if _, err := d.Token(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("confluence output is not well formed: %v", err)
+		}
+	}
+}
+
+func TestNameCaser(t *testing.T) {
+	tests := []struct {
+		nameCase string
+		name     string
+		want     string
+	}{
+		{"lower", "Go Docs ŻÓŁW", "go docs żółw"},
+		{"upper", "Go docs żółw", "GO DOCS ŻÓŁW"},
+		{"title", "the GO programming-language", "The Go Programming-Language"},
+		{"title", "don't stop 2nd o’clock", "Don't Stop 2nd O’clock"},
+		{"title", "'quoted' ǆemal", "'Quoted' ǅemal"},
+	}
+	for _, tt := range tests {
+		caser, err := nameCaser(tt.nameCase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := caser(tt.name); got != tt.want {
+			t.Errorf("%s case of %q = %q, want %q", tt.nameCase, tt.name, got, tt.want)
+		}
+	}
+	if caser, err := nameCaser("none"); caser != nil || err != nil {
+		t.Errorf("nameCaser(none) = %p, %v, want nil", caser, err)
+	}
+	if _, err := nameCaser("camel"); err == nil {
+		t.Error("nameCaser() succeeded for unknown case")
+	}
+}
+
+func TestRegisteredDomain(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"gist.github.com", "github.com"},
+		{"github.com", "github.com"},
+		{"WWW.Example.COM.", "example.com"},
+		{"news.bbc.co.uk", "bbc.co.uk"},
+		{"bbc.co.uk", "bbc.co.uk"},
+		{"a.b.example.com.au", "example.com.au"},
+		{"daishe.github.io", "daishe.github.io"},
+		{"docs.daishe.github.io", "daishe.github.io"},
+		{"my-app.herokuapp.com", "my-app.herokuapp.com"},
+		{"co.uk", "co.uk"},
+		{"www.example.co", "example.co"},
+		{"shop.example.ltd.uk", "example.ltd.uk"},
+		{"www.example.co.jp", "example.co.jp"},
+		{"bucket.s3.amazonaws.com", "bucket.s3.amazonaws.com"},
+		{"assets.bucket.s3.amazonaws.com", "bucket.s3.amazonaws.com"},
+		{"s3.amazonaws.com", "s3.amazonaws.com"},
+		{"store.myshopify.com", "store.myshopify.com"},
+		{"a.b.example.zz", "example.zz"},
+		{"city.kawasaki.jp", "kawasaki.jp"},
+		{"localhost", "localhost"},
+		{"192.168.1.10", "192.168.1.10"},
+		{"::1", "::1"},
+	}
+	for _, tt := range tests {
+		if got := registeredDomain(tt.host); got != tt.want {
+			t.Errorf("registeredDomain(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestGroupByHost(t *testing.T) {
+	data := `{"version": 1, "roots": {"other": {"name": "Other", "type": "folder", "children": [
+		{"name": "Gist", "type": "url", "url": "https://gist.github.com/x"},
+		{"name": "Note", "type": "url", "url": "about:blank"},
+		{"name": "GitHub", "type": "url", "url": "https://WWW.GitHub.com/"},
+		{"name": "Docs", "type": "folder", "children": [
+			{"name": "Go", "type": "url", "url": "https://go.dev/doc/"}
+		]}
+	]}}}`
+	tests := []struct {
+		by       string
+		stripWww bool
+		want     string
+	}{
+		{"domain", false, "gist.github.com(Gist) go.dev(Go) www.github.com(GitHub) (no host)(Note)"},
+		{"domain", true, "gist.github.com(Gist) github.com(GitHub) go.dev(Go) (no host)(Note)"},
+		{"tld", false, "github.com(Gist GitHub) go.dev(Go) (no host)(Note)"},
+	}
+	for _, tt := range tests {
+		b, err := groupByHost(mustParse(t, data), tt.by, tt.stripWww)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := treeString(rootEntries(b)); got != tt.want {
+			t.Errorf("groupByHost(%s, %v) = %s, want %s", tt.by, tt.stripWww, got, tt.want)
+		}
+	}
+	if _, err := groupByHost(mustParse(t, data), "path", false); err == nil {
+		t.Error("groupByHost() succeeded for unknown grouping")
+	}
+}
+
+func TestWriteZipDocuments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bookmarks.zip")
+	profiles := []*profile{
+		testProfile(t, "Default", testBookmarks),
+		testProfile(t, "backup/Profile 1", specialBookmarks),
+		testProfile(t, "backup:Profile 1", testBookmarks),
+		testProfile(t, "index", testBookmarks),
+	}
+	f, err := findFormat("markdown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeZipDocuments(path, f, &config{indent: "\t", baseHeadingLevel: 1}, profiles); err != nil {
+		t.Fatal(err)
+	}
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	files := map[string]string{}
+	names := []string(nil)
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, f.Name)
+		files[f.Name] = string(data)
+	}
+	if want := []string{"Default.md", "backup-Profile 1.md", "backup-Profile 1-2.md", "index-2.md", "index.md"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("zip entries = %q, want %q", names, want)
+	}
+	wantIndex := "# Chrome bookmarks\n\n" +
+		"- [Profile Default](Default.md)\n" +
+		"- [Profile backup/Profile 1](backup-Profile%201.md)\n" +
+		"- [Profile backup:Profile 1](backup-Profile%201-2.md)\n" +
+		"- [Profile index](index-2.md)\n"
+	if got := files["index.md"]; got != wantIndex {
+		t.Errorf("index.md = %q, want %q", got, wantIndex)
+	}
+	if got, want := files["Default.md"], renderDocument(t, "markdown", &config{indent: "\t", baseHeadingLevel: 1}, profiles[0]); got != want {
+		t.Errorf("Default.md = %q, want %q", got, want)
+	}
+}
+
+func TestIndentGuides(t *testing.T) {
+	tests := []struct {
+		guides bool
+		want   string
+	}{
+		{false, "Profile Default\n" +
+			"├── Bookmarks bar\n" +
+			"│   ├── Go (https://go.dev/)\n" +
+			"│   └── Docs\n" +
+			"│       └── Effective Go (https://go.dev/doc/effective_go)\n" +
+			"├── Other bookmarks\n" +
+			"│   └── Example (https://www.example.com/a?x=1#top)\n" +
+			"└── Mobile bookmarks\n\n"},
+		{true, "Profile Default\n" +
+			"├─┬ Bookmarks bar\n" +
+			"│ ├── Go (https://go.dev/)\n" +
+			"│ └─┬ Docs\n" +
+			"│   └── Effective Go (https://go.dev/doc/effective_go)\n" +
+			"├─┬ Other bookmarks\n" +
+			"│ └── Example (https://www.example.com/a?x=1#top)\n" +
+			"└── Mobile bookmarks\n\n"},
+	}
+	for _, tt := range tests {
+		got := renderProfile(t, "tree", &config{indentGuides: tt.guides}, testProfile(t, "Default", testBookmarks))
+		if got != tt.want {
+			t.Errorf("tree output with indent guides %v = %q, want %q", tt.guides, got, tt.want)
+		}
+	}
+
+	// guides of levels with following siblings continue, while levels
+	// below last entries are left blank
+	data := `{"version": 1, "roots": {
+		"bookmark_bar": {"name": "Bar", "type": "folder", "children": [
+			{"name": "A", "type": "folder", "children": [
+				{"name": "B", "type": "folder", "children": [
+					{"name": "C", "type": "folder", "children": [
+						{"name": "Go", "type": "url", "url": "https://go.dev/"}
+					]},
+					{"name": "D", "type": "url", "url": "https://d.example/"}
+				]}
+			]},
+			{"name": "E", "type": "url", "url": "https://e.example/"}
+		]},
+		"other": {"name": "Other", "type": "folder", "children": [
+			{"name": "F", "type": "folder", "children": [
+				{"name": "G", "type": "url", "url": "https://g.example/"}
+			]}
+		]}
+	}}`
+	want := "Profile Default\n" +
+		"├─┬ Bar\n" +
+		"│ ├─┬ A\n" +
+		"│ │ └─┬ B\n" +
+		"│ │   ├─┬ C\n" +
+		"│ │   │ └── Go (https://go.dev/)\n" +
+		"│ │   └── D (https://d.example/)\n" +
+		"│ └── E (https://e.example/)\n" +
+		"└─┬ Other\n" +
+		"  └─┬ F\n" +
+		"    └── G (https://g.example/)\n\n"
+	if got := renderProfile(t, "tree", &config{indentGuides: true}, testProfile(t, "Default", data)); got != want {
+		t.Errorf("tree output of multiple levels with indent guides = %q, want %q", got, want)
+	}
+}
+
+func TestIsStale(t *testing.T) {
+	day := func(s string) time.Time {
+		d, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	tests := []struct {
+		lastUsed string
+		since    time.Time
+		want     bool
+	}{
+		{"13300000000000000", day("2022-06-18"), false},
+		{"13300000000000000", day("2022-06-19"), true},
+		{"0", day("2000-01-01"), true},
+		{"", day("2000-01-01"), true},
+	}
+	for _, tt := range tests {
+		if got := isStale(&bookmarksEntry{DateLastUsed: tt.lastUsed}, tt.since); got != tt.want {
+			t.Errorf("isStale(%q, %s) = %v, want %v", tt.lastUsed, tt.since.Format("2006-01-02"), got, tt.want)
+		}
+	}
+}
+
+func TestShowLastUsed(t *testing.T) {
+	data := `{"version": 1, "roots": {"other": {"name": "Other", "type": "folder", "date_last_used": "13300000000000000", "children": [
+		{"name": "Used", "type": "url", "url": "https://a.example/", "date_last_used": "13300000000000000"},
+		{"name": "Unused", "type": "url", "url": "https://b.example/", "date_last_used": "0"}
+	]}}}`
+	want := "## Profile Default\n- Other\n\t- [Used](https://a.example/) (last used 2022-06-18)\n\t- [Unused](https://b.example/) (never used)\n\n"
+	if got := renderProfile(t, "markdown", &config{indent: "\t", baseHeadingLevel: 1, showLastUsed: true}, testProfile(t, "Default", data)); got != want {
+		t.Errorf("markdown output = %q, want %q", got, want)
+	}
+}
+
+func TestProfilesFilterPatterns(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  *profilesFilter
+		names   []string
+		profile string
+		want    bool
+	}{
+		{"pattern match", &profilesFilter{patterns: []*regexp.Regexp{regexp.MustCompile(`^Profile \d+$`)}}, nil, "Profile 12", true},
+		{"pattern mismatch", &profilesFilter{patterns: []*regexp.Regexp{regexp.MustCompile(`^Profile \d+$`)}}, nil, "Profile x", false},
+		{"pattern or name", &profilesFilter{patterns: []*regexp.Regexp{regexp.MustCompile(`^Work`)}}, []string{"Default"}, "Default", true},
+		{"case insensitive pattern", &profilesFilter{patterns: []*regexp.Regexp{regexp.MustCompile(`(?i)^work`)}}, nil, "Work/Team", true},
+		{"ignore case names", &profilesFilter{ignoreCase: true}, []string{"DEFAULT"}, "Default", true},
+		{"case sensitive names", &profilesFilter{}, []string{"DEFAULT"}, "Default", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.filter.add(tt.names...)
+			if got := tt.filter.includes(tt.profile); got != tt.want {
+				t.Errorf("includes(%q) = %v, want %v", tt.profile, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJsonTreeFormatter(t *testing.T) {
+	want := `[
+  {
+    "profile": "Default",
+    "entries": [
+      {
+        "name": "Bookmarks bar",
+        "children": [
+          {
+            "name": "Go",
+            "url": "https://go.dev/"
+          },
+          {
+            "name": "Docs",
+            "children": [
+              {
+                "name": "Effective Go",
+                "url": "https://go.dev/doc/effective_go"
+              }
+            ]
+          }
+        ]
+      },
+      {
+        "name": "Other bookmarks",
+        "children": [
+          {
+            "name": "Example",
+            "url": "https://www.example.com/a?x=1#top"
+          }
+        ]
+      },
+      {
+        "name": "Mobile bookmarks"
+      }
+    ]
+  },
+  {
+    "profile": "Special",
+    "entries": [
+      {
+        "name": "A*b",
+        "children": [
+          {
+            "name": "x_[y]` + "`" + `z",
+            "url": "https://e.example/a[1] b"
+          }
+        ]
+      }
+    ]
+  }
+]
+`
+	got := renderDocument(t, "json-tree", &config{}, testProfile(t, "Default", testBookmarks), testProfile(t, "Special", specialBookmarks))
+	if got != want {
+		t.Errorf("json-tree output = %s, want %s", got, want)
+	}
+	if !json.Valid([]byte(renderDocument(t, "json-tree", &config{}))) {
+		t.Error("json-tree output without profiles is not valid JSON")
+	}
+}
+
+func TestParseDays(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"30d", 30 * 24 * time.Hour, false},
+		{"2w", 14 * 24 * time.Hour, false},
+		{"1.5d", 36 * time.Hour, false},
+		{"12h", 12 * time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"0d", 0, false},
+		{"-1d", 0, true},
+		{"d", 0, true},
+		{"30", 0, true},
+		{"soon", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseDays(tt.s)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseDays(%q) error = %v, wantErr %v", tt.s, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseDays(%q) = %s, want %s", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestCreateFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file permissions are not supported on windows")
+	}
+	tests := []struct {
+		name     string
+		existing bool
+		mode     os.FileMode
+	}{
+		{"new file", false, 0o600},
+		{"existing file", true, 0o640},
+		{"executable", false, 0o750},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "bookmarks.md")
+			if tt.existing {
+				if err := os.WriteFile(path, []byte("old content"), 0o666); err != nil {
+					t.Fatal(err)
+				}
+			}
+			f, err := createFile(path, tt.mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := info.Mode().Perm(); got != tt.mode {
+				t.Errorf("createFile() mode = %v, want %v", got, tt.mode)
+			}
+			if info.Size() != 0 {
+				t.Errorf("createFile() left %d bytes of old content", info.Size())
+			}
+		})
+	}
+}
+
+func TestCombineRoots(t *testing.T) {
+	data := `{"version": 1, "roots": {
+		"bookmark_bar": {"name": "Bar", "type": "folder", "children": [
+			{"name": "Docs", "type": "folder", "children": [{"name": "A", "type": "url", "url": "https://a.example/"}]}
+		]},
+		"other": {"name": "Other", "type": "folder", "children": [
+			{"name": "Docs", "type": "folder", "children": [{"name": "B", "type": "url", "url": "https://b.example/"}]},
+			{"name": "C", "type": "url", "url": "https://c.example/"}
+		]}
+	}}`
+	tests := []struct {
+		mergeFolders bool
+		want         string
+	}{
+		{false, "Docs(A) Docs(B) C"},
+		{true, "Docs(A B) C"},
+	}
+	for _, tt := range tests {
+		b := combineRoots(mustParse(t, data), tt.mergeFolders, "Default")
+		if !b.flat || len(b.Roots) != 1 {
+			t.Fatalf("combineRoots() returned %d roots, want single flat root", len(b.Roots))
+		}
+		if got := treeString(topEntries(b)); got != tt.want {
+			t.Errorf("combineRoots(%v) = %s, want %s", tt.mergeFolders, got, tt.want)
+		}
+	}
+	want := "## Profile Default\n- Docs\n\t- [A](https://a.example/)\n\t- [B](https://b.example/)\n- [C](https://c.example/)\n\n"
+	p := &profile{name: "Default", bookmarks: combineRoots(mustParse(t, data), true, "Default")}
+	if got := renderProfile(t, "markdown", &config{indent: "\t", baseHeadingLevel: 1}, p); got != want {
+		t.Errorf("markdown output = %q, want %q", got, want)
+	}
+}
+
+func TestXmlDeclaration(t *testing.T) {
+	urlset := "<urlset xmlns=\"http://www.sitemaps.org/schemas/sitemap/0.9\">\n" +
+		"  <url>\n    <loc>https://go.dev/</loc>\n  </url>\n" +
+		"  <url>\n    <loc>https://go.dev/doc/effective_go</loc>\n  </url>\n" +
+		"  <url>\n    <loc>https://www.example.com/a?x=1#top</loc>\n  </url>\n" +
+		"</urlset>\n"
+	tests := []struct {
+		declaration bool
+		want        string
+	}{
+		{true, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n" + urlset},
+		{false, urlset},
+	}
+	for _, tt := range tests {
+		got := renderDocument(t, "sitemap", &config{xmlDeclaration: tt.declaration}, testProfile(t, "Default", testBookmarks))
+		if got != tt.want {
+			t.Errorf("sitemap output with declaration %v = %q, want %q", tt.declaration, got, tt.want)
+		}
+	}
+}
+
+func TestWithRetries(t *testing.T) {
+	errFailed := errors.New("input/output error")
+	tests := []struct {
+		name      string
+		failures  int
+		retries   int
+		err       error
+		wantCalls int
+		wantErr   bool
+	}{
+		{"success", 0, 3, errFailed, 1, false},
+		{"transient failures", 2, 3, errFailed, 3, false},
+		{"all retries failed", 5, 2, errFailed, 3, true},
+		{"no retries", 1, 0, errFailed, 1, true},
+		{"missing file not retried", 1, 3, fs.ErrNotExist, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			var err error
+			warnings := captureStderr(t, func() {
+				err = withRetries(tt.retries, time.Millisecond, "reading Bookmarks", func() error {
+					calls++
+					if calls <= tt.failures {
+						return tt.err
+					}
+					return nil
+				})
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("withRetries() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("withRetries() made %d calls, want %d", calls, tt.wantCalls)
+			}
+			if got := len(lines(warnings)); got != tt.wantCalls-1 {
+				t.Errorf("withRetries() reported %d warnings, want %d", got, tt.wantCalls-1)
+			}
+		})
+	}
+}
+
+func TestRetryingRead(t *testing.T) {
+	calls := 0
+	src := bookmarksSource{path: "Bookmarks", read: func() ([]byte, error) {
+		calls++
+		if calls < 3 {
+			return nil, errors.New("stale file handle")
+		}
+		return []byte(testBookmarks), nil
+	}}
+	var data []byte
+	var err error
+	captureStderr(t, func() { data, err = retryingRead(src, 2, time.Millisecond)() })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != testBookmarks || calls != 3 {
+		t.Errorf("retryingRead() made %d calls and returned %d bytes", calls, len(data))
+	}
+}
+
+func TestSummaryTree(t *testing.T) {
+	want := "# Chrome bookmarks\n\n" +
+		"> This document was automatically generated by [chrome-bookmarks-to-markdown](https://github.com/daishe/chrome-bookmarks-to-markdown).\n\n" +
+		"> Folders overview\n\n" +
+		"## Profile Default\n- Bookmarks bar\n\t- Docs\n- Other bookmarks\n- Mobile bookmarks\n\n" +
+		"> All bookmarks\n\n" +
+		"## Profile Default\n- Bookmarks bar\n\t- [Go](https://go.dev/)\n\t- Docs\n\t\t- [Effective Go](https://go.dev/doc/effective_go)\n" +
+		"- Other bookmarks\n\t- [Example](https://www.example.com/a?x=1#top)\n- Mobile bookmarks\n\n"
+	got := renderDocument(t, "markdown", &config{indent: "\t", baseHeadingLevel: 1, summaryTree: true}, testProfile(t, "Default", testBookmarks))
+	if got != want {
+		t.Errorf("markdown output = %q, want %q", got, want)
+	}
+	flat := testProfile(t, "Default", testBookmarks)
+	flat.bookmarks = flattenBookmarks(flat.bookmarks, nil)
+	got = renderDocument(t, "markdown", &config{indent: "\t", baseHeadingLevel: 1, summaryTree: true}, flat)
+	if i := strings.Index(got, "> All bookmarks"); i < 0 || strings.Contains(got[:i], "## Profile") {
+		t.Errorf("markdown output of flat bookmarks has folders overview: %q", got)
+	}
+}
+
+func TestSummaryTreeMaxChildren(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "Default/Bookmarks")
+	stdout, stderr, code := runMain(t, "-input", dir, "-summary-tree", "-max-children", "1", "-redact-names")
+	if code != 0 {
+		t.Fatalf("exit code = %d, want 0 (stderr %q)", code, stderr)
+	}
+	// overview lists folders dropped from the capped listing, without
+	// counting them as omitted
+	want := "> Folders overview\n\n" +
+		"## Profile Default\n- Bookmarks bar\n\t- " + shortHash("Docs") + "\n- Other bookmarks\n- Mobile bookmarks\n\n" +
+		"> All bookmarks\n\n" +
+		"## Profile Default\n- Bookmarks bar\n\t- [" + shortHash("Go") + "](https://go.dev/)\n\t- … and 1 more\n" +
+		"- Other bookmarks\n\t- [" + shortHash("Example") + "](https://www.example.com/a?x=1#top)\n- Mobile bookmarks\n\n"
+	if !strings.HasSuffix(stdout, want) {
+		t.Errorf("output = %q, want suffix %q", stdout, want)
+	}
+}
+
+func TestLimitNestingCycles(t *testing.T) {
+	folder := &bookmarksEntry{Name: "Loop", Type: "folder"}
+	inner := &bookmarksEntry{Name: "Inner", Type: "folder", Children: []*bookmarksEntry{folder}}
+	shared := &bookmarksEntry{Name: "Go", Type: "url", Url: "https://go.dev/"}
+	folder.Children = []*bookmarksEntry{shared, inner, nil}
+	root := &bookmarksEntry{Name: "Other", Type: "folder", Children: []*bookmarksEntry{folder, shared}}
+	root.Children = append(root.Children, root)
+	b := &bookmarks{Roots: map[string]*bookmarksEntry{"other": root}}
+
+	errors := captureStderr(t, func() { limitNesting(b, 100, "Bookmarks") })
+	want := []string{
+		`Error: bookmarks file Bookmarks: folder "Inner" contains circular reference to "Loop", the reference has been skipped`,
+		`Error: bookmarks file Bookmarks: folder "Loop" contains null entry, it has been skipped`,
+		`Error: bookmarks file Bookmarks: folder "Other" contains circular reference to "Other", the reference has been skipped`,
+	}
+	if got := lines(errors); !reflect.DeepEqual(got, want) {
+		t.Errorf("limitNesting() reported %q, want %q", got, want)
+	}
+	if got := treeString(rootEntries(b)); got != "Other(Loop(Go Inner) Go)" {
+		t.Errorf("limitNesting() left %s", got)
+	}
+	got := renderProfile(t, "markdown", &config{indent: "\t", baseHeadingLevel: 1}, &profile{name: "Default", bookmarks: b})
+	if want := "## Profile Default\n- Other\n\t- Loop\n\t\t- [Go](https://go.dev/)\n\t\t- Inner\n\t- [Go](https://go.dev/)\n\n"; got != want {
+		t.Errorf("markdown output = %q, want %q", got, want)
+	}
+}
+
+func TestStripWwwHost(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://www.example.com/a?x=1", "https://example.com/a?x=1"},
+		{"http://WWW.example.com/", "http://example.com/"},
+		{"https://example.com/www.", "https://example.com/www."},
+		{"https://www2.example.com/", "https://www2.example.com/"},
+		{"https://www./", "https://www./"},
+		{"javascript:alert(1)", "javascript:alert(1)"},
+		{"%zz", "%zz"},
+	}
+	for _, tt := range tests {
+		if got := stripWwwHost(tt.url); got != tt.want {
+			t.Errorf("stripWwwHost(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestDedupeStripWww(t *testing.T) {
+	data := `{"version": 1, "roots": {"other": {"name": "Other", "type": "folder", "children": [
+		{"name": "Bare", "type": "url", "url": "https://example.com/"},
+		{"name": "Www", "type": "url", "url": "https://www.example.com/"},
+		{"name": "Other", "type": "url", "url": "https://www.example.org/"}
+	]}}}`
+	tests := []struct {
+		stripWww bool
+		want     string
+	}{
+		{false, "Other(Bare Www Other)"},
+		{true, "Other(Bare Other)"},
+	}
+	for _, tt := range tests {
+		b := mustParse(t, data)
+		if err := dedupeBookmarks(b, "first", "url", tt.stripWww); err != nil {
+			t.Fatal(err)
+		}
+		if got := treeString(rootEntries(b)); got != tt.want {
+			t.Errorf("dedupeBookmarks(stripWww %v) = %s, want %s", tt.stripWww, got, tt.want)
+		}
+	}
+	b := mustParse(t, data)
+	if err := dedupeBookmarks(b, "last", "url", true); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.Roots["other"].Children[0].Url; got != "https://www.example.com/" {
+		t.Errorf("dedupeBookmarks() kept URL %q, want original https://www.example.com/", got)
+	}
+}
+
+func TestPreviewWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		lines  int
+		writes []string
+		want   string
+	}{
+		{"fewer lines", 5, []string{"a\n", "b\n"}, "a\nb\n"},
+		{"exactly", 2, []string{"a\n", "b\n", "c\n"}, "a\nb\n"},
+		{"split within write", 2, []string{"a\nb\nc\nd\n"}, "a\nb\n"},
+		{"partial lines", 2, []string{"a", "b\nc", "d\ne\n", "f\n"}, "ab\ncd\n"},
+		{"single line", 1, []string{"## Profile\n- a\n"}, "## Profile\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bufferOutput{}
+			w := &previewWriter{WriteSyncCloser: out, lines: tt.lines}
+			for _, s := range tt.writes {
+				if n, err := w.Write([]byte(s)); n != len(s) || err != nil {
+					t.Fatalf("Write(%q) = %d, %v, want %d, nil", s, n, err, len(s))
+				}
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("previewWriter output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreviewLines(t *testing.T) {
+	out := &bufferOutput{}
+	w, err := wrapOutput(out, &config{previewLines: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := findFormat("markdown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config{indent: "\t", baseHeadingLevel: 1}
+	if err := writeDocument(outputTarget{f.makeFormatter(cfg), w}, []*profile{testProfile(t, "Default", testBookmarks)}, "", cfg); err != nil {
+		t.Fatal(err)
+	}
+	want := "# Chrome bookmarks\n\n> This document was automatically generated by [chrome-bookmarks-to-markdown](https://github.com/daishe/chrome-bookmarks-to-markdown).\n"
+	if got := out.String(); got != want {
+		t.Errorf("preview output = %q, want %q", got, want)
+	}
+}
+
+// taggedBookmarks holds bookmarks with tags stored under "tags" meta info key.
+const taggedBookmarks = `{"version": 1, "roots": {"other": {"name": "Other", "type": "folder", "children": [
+	{"name": "Go", "type": "url", "url": "https://go.dev/", "meta_info": {"tags": "lang, go"}},
+	{"name": "Docs", "type": "folder", "children": [
+		{"name": "Rust", "type": "url", "url": "https://rust-lang.org/", "meta_info": {"tags": "lang"}}
+	]},
+	{"name": "News", "type": "url", "url": "https://news.example/", "meta_info": {"tags": " , "}}
+]}}}`
+
+func TestEntryTags(t *testing.T) {
+	tests := []struct {
+		meta map[string]string
+		want []string
+	}{
+		{map[string]string{"tags": "go"}, []string{"go"}},
+		{map[string]string{"tags": " lang , go,,"}, []string{"lang", "go"}},
+		{map[string]string{"tags": ""}, nil},
+		{map[string]string{"labels": "go"}, nil},
+		{nil, nil},
+	}
+	for _, tt := range tests {
+		if got := entryTags(&bookmarksEntry{MetaInfo: tt.meta}, "tags"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("entryTags(%v) = %q, want %q", tt.meta, got, tt.want)
+		}
+	}
+}
+
+func TestGroupByTag(t *testing.T) {
+	b := groupByTag(mustParse(t, taggedBookmarks), "tags")
+	if got, want := treeString(rootEntries(b)), "go(Go) lang(Go Rust) Untagged(News)"; got != want {
+		t.Errorf("groupByTag() = %s, want %s", got, want)
+	}
+	want := "## Profile Default\n\n### go\n- [Go](https://go.dev/)\n\n### lang\n- [Go](https://go.dev/)\n- [Rust](https://rust-lang.org/)\n\n### Untagged\n- [News](https://news.example/)\n\n"
+	if got := renderProfile(t, "markdown", &config{indent: "\t", baseHeadingLevel: 1}, &profile{name: "Default", bookmarks: b}); got != want {
+		t.Errorf("markdown output = %q, want %q", got, want)
+	}
+}
+
+func TestTagsAnnotation(t *testing.T) {
+	want := "## Profile Default\n- Other\n\t- [Go](https://go.dev/) #lang #go\n\t- Docs\n\t\t- [Rust](https://rust-lang.org/) #lang\n\t- [News](https://news.example/)\n\n"
+	if got := renderProfile(t, "markdown", &config{indent: "\t", baseHeadingLevel: 1, tagsKey: "tags"}, testProfile(t, "Default", taggedBookmarks)); got != want {
+		t.Errorf("markdown output = %q, want %q", got, want)
+	}
+}
+
+func TestParseStrictBookmarks(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string // error of strict parsing, empty when it succeeds
+	}{
+		{"known fields", testBookmarks, ""},
+		{"unknown top level field", `{"version": 1, "roots": {}, "sync_transaction_version": "5"}`, `bookmarks file Bookmarks: json: unknown field "sync_transaction_version"`},
+		{"unknown entry field", `{"version": 1, "roots": {"other": {"name": "Other", "type": "folder", "visit_count": 3}}}`, `bookmarks file Bookmarks: json: unknown field "visit_count"`},
+		{"unknown version 2 field", `{"version": 2, "roots": {"other": {"name": "Other", "type": "folder", "nodes": [
+			{"name": "Go", "type": "url", "url": "https://go.dev/", "favicon": "x"}
+		]}}}`, `bookmarks file Bookmarks: json: unknown field "favicon"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseBookmarks([]byte(tt.data), "Bookmarks"); err != nil {
+				t.Errorf("parseBookmarks() error = %v", err)
+			}
+			_, err := parseStrictBookmarks([]byte(tt.data), "Bookmarks")
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("parseStrictBookmarks() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("parseStrictBookmarks() error = %v, want %s", err, tt.wantErr)
+			}
+			if exitCode(err) != exitParse {
+				t.Errorf("exitCode(%v) = %d, want %d", err, exitCode(err), exitParse)
+			}
+		})
+	}
+
+	// other errors are returned as they are
+	_, err := parseStrictBookmarks([]byte(`{"version": 1, "roots": {"other": {"name": 5}}}`), "Bookmarks")
+	var typeErr *json.UnmarshalTypeError
+	if !errors.As(err, &typeErr) || isUnknownFieldError(err) {
+		t.Errorf("parseStrictBookmarks() error = %v, want type error", err)
+	}
+}
+
+func TestProfileSeparator(t *testing.T) {
+	one := `{"version": 1, "roots": {"other": {"name": "O", "type": "folder", "children": [{"name": "G", "type": "url", "url": "https://go.dev/"}]}}}`
+	profiles := []*profile{testProfile(t, "A", one), testProfile(t, "B", one), testProfile(t, "C", one)}
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"markdown", "## Profile A\n- O\n\t- [G](https://go.dev/)\n\n---\n\n## Profile B\n- O\n\t- [G](https://go.dev/)\n\n---\n\n## Profile C\n- O\n\t- [G](https://go.dev/)\n\n"},
+		{"tree", "Profile A\n└── O\n    └── G (https://go.dev/)\n\n---\n\nProfile B\n└── O\n    └── G (https://go.dev/)\n\n---\n\nProfile C\n└── O\n    └── G (https://go.dev/)\n\n"},
+		{"asciidoc", "== Profile A\n\n* O\n** link:https://go.dev/[G]\n\n---\n\n== Profile B\n\n* O\n** link:https://go.dev/[G]\n\n---\n\n== Profile C\n\n* O\n** link:https://go.dev/[G]\n\n"},
+	}
+	for _, tt := range tests {
+		got := renderDocument(t, tt.format, &config{indent: "\t", baseHeadingLevel: 1, profileSeparator: "---"}, profiles...)
+		if !strings.HasSuffix(got, tt.want) {
+			t.Errorf("%s output = %q, want it to end with %q", tt.format, got, tt.want)
+		}
+	}
+	for _, format := range []string{"json-tree", "jsonl", "urls", "sitemap"} {
+		without := renderDocument(t, format, &config{}, profiles...)
+		if got := renderDocument(t, format, &config{profileSeparator: "---"}, profiles...); got != without {
+			t.Errorf("%s output with separator = %q, want unchanged %q", format, got, without)
+		}
+	}
+	if got := renderDocument(t, "markdown", &config{indent: "\t", baseHeadingLevel: 1, profileSeparator: "---"}, profiles[0]); strings.Contains(got, "---") {
+		t.Errorf("markdown output of single profile contains separator: %q", got)
+	}
+}
+
+// checksumBookmarks is a Bookmarks file with checksum matching its content.
+const checksumBookmarks = `{"version": 1, "checksum": "589aff6b2556ad362c823a95ce6598df", "sync_metadata": "abc", "roots": {
+	"other": {"id": "5", "name": "Other bookmarks", "type": "folder", "children": []},
+	"bookmark_bar": {"id": "1", "name": "Bookmarks bar", "type": "folder", "children": [
+		{"id": "2", "name": "Gó", "type": "url", "url": "https://go.dev/"},
+		{"id": "3", "name": "Docs", "type": "folder", "children": [
+			{"id": "4", "name": "Effective Go", "type": "url", "url": "https://go.dev/doc/effective_go"}
+		]}
+	]},
+	"synced": {"id": "6", "name": "Mobile bookmarks", "type": "folder", "children": []},
+	"custom": {"id": "7", "name": "Not hashed", "type": "folder", "children": []}
+}}`
+
+func TestChromeChecksum(t *testing.T) {
+	b := mustParse(t, checksumBookmarks)
+	if got, want := chromeChecksum(b), "589aff6b2556ad362c823a95ce6598df"; got != want {
+		t.Errorf("chromeChecksum() = %s, want %s", got, want)
+	}
+	b.Roots["bookmark_bar"].Children[0].Url = "https://go.dev/x"
+	if got := chromeChecksum(b); got == "589aff6b2556ad362c823a95ce6598df" {
+		t.Error("chromeChecksum() did not change after modifying URL")
+	}
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	tests := []struct {
+		name     string
+		checksum string
+		want     string
+	}{
+		{"matching", "589aff6b2556ad362c823a95ce6598df", ""},
+		{"matching upper case", "589AFF6B2556AD362C823A95CE6598DF", ""},
+		{"mismatch", "00000000000000000000000000000000", "Warning: bookmarks file Bookmarks: checksum mismatch, stored 00000000000000000000000000000000 but content has 589aff6b2556ad362c823a95ce6598df, the file may be corrupted or modified outside of Chrome\n"},
+		{"missing", "", "Warning: bookmarks file Bookmarks: no checksum stored, content cannot be verified\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := mustParse(t, checksumBookmarks)
+			b.Checksum = tt.checksum
+			if got := captureStderr(t, func() { verifyChecksum(b, "Bookmarks") }); got != tt.want {
+				t.Errorf("verifyChecksum() reported %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNameReplacer(t *testing.T) {
+	tests := []struct {
+		name     string
+		pairs    string
+		useRegex bool
+		in       []string
+		want     []string
+	}{
+		{"strip prefix", "[work] =", false, []string{"[work] Jira", "[work] Wiki", "Home"}, []string{"Jira", "Wiki", "Home"}},
+		{"pairs in order", "a=b,b=c", false, []string{"abc"}, []string{"ccc"}},
+		{"regex prefix", `^\[\w+\] =`, true, []string{"[work] Jira", "[home] Mail", "x [work] y"}, []string{"Jira", "Mail", "x [work] y"}},
+		{"regex groups", `(\w+)@(\w+)=$2/$1`, true, []string{"issues@jira"}, []string{"jira/issues"}},
+		{"empty pairs skipped", ",x=y,", false, []string{"xx"}, []string{"yy"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replace, err := nameReplacer(tt.pairs, tt.useRegex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string(nil)
+			for _, s := range tt.in {
+				got = append(got, replace(s))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("replaced names = %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if replace, err := nameReplacer("", false); replace != nil || err != nil {
+		t.Errorf("nameReplacer(\"\") = %v, %v, want nil, nil", replace != nil, err)
+	}
+	for _, pairs := range []string{"noequals", "=new"} {
+		if _, err := nameReplacer(pairs, false); err == nil {
+			t.Errorf("nameReplacer(%q) succeeded", pairs)
+		}
+	}
+	if _, err := nameReplacer("(=x", true); err == nil {
+		t.Error("nameReplacer() succeeded for invalid pattern")
+	}
+}
+
+func TestDokuwikiFormatter(t *testing.T) {
+	testFormatter(t, "dokuwiki",
+		"===== Profile Default =====\n\n"+
+			"  * Bookmarks bar\n"+
+			"    * [[https://go.dev/|Go]]\n"+
+			"    * Docs\n"+
+			"      * [[https://go.dev/doc/effective_go|Effective Go]]\n"+
+			"  * Other bookmarks\n"+
+			"    * [[https://www.example.com/a?x=1#top|Example]]\n"+
+			"  * Mobile bookmarks\n\n",
+		"===== Profile Default =====\n\n"+
+			"  * A*b\n"+
+			"    * [[https://e.example/a%5B1%5D%20b|x_[y]`z]]\n\n")
+}
+
+func TestDokuwikiText(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Plain text", "Plain text"},
+		{"a*b_c", "a*b_c"},
+		{"**bold**", "%%**bold**%%"},
+		{"https://go.dev/", "%%https://go.dev/%%"},
+		{"a | b", "%%a | b%%"},
+		{"100%% sure [[x]]", "%%100% % sure [[x]]%%"},
+	}
+	for _, tt := range tests {
+		if got := dokuwikiText(tt.text); got != tt.want {
+			t.Errorf("dokuwikiText(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+	if got, want := dokuwikiLinkTitle.Replace("[[a]] {{b}}"), "[ [a] ] { {b} }"; got != want {
+		t.Errorf("dokuwikiLinkTitle.Replace() = %q, want %q", got, want)
+	}
+}
+
+func TestUrlProblem(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://go.dev/doc/", ""},
+		{"HTTP://Example.com", ""},
+		{"chrome://settings/", ""},
+		{"javascript:void(0)", ""},
+		{"mailto:a@example.com", ""},
+		{"", "URL is empty"},
+		{"  ", "URL is empty"},
+		{"https://example.com/a b", "URL contains white space"},
+		{"https://example.com/\ta", "URL contains white space"},
+		{"example.com/page", "URL has no scheme"},
+		{"/relative/path", "URL has no scheme"},
+		{"https:///path", "URL has no host"},
+		{"http:example.com", "URL has no host"},
+	}
+	for _, tt := range tests {
+		if got := urlProblem(tt.url); got != tt.want {
+			t.Errorf("urlProblem(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+	if got := urlProblem("https://exa%mple.com/"); got == "" {
+		t.Error("urlProblem() found no problem with unparsable URL")
+	}
+}
+
+func TestValidateUrls(t *testing.T) {
+	b := mustParse(t, `{"version": 1, "roots": {"other": {"name": "Other", "type": "folder", "children": [
+		{"name": "Go", "type": "url", "url": "https://go.dev/"},
+		{"name": "Bare", "type": "url", "url": "example.com"},
+		{"name": "Docs", "type": "folder", "children": [
+			{"name": "Spaces", "type": "url", "url": "https://example.com/a b"}
+		]}
+	]}}}`)
+	n := 0
+	warnings := captureStderr(t, func() { n = validateUrls(b, "Bookmarks") })
+	want := []string{
+		`Warning: bookmarks file Bookmarks: bookmark "Bare" has malformed URL "example.com": URL has no scheme`,
+		`Warning: bookmarks file Bookmarks: bookmark "Spaces" has malformed URL "https://example.com/a b": URL contains white space`,
+	}
+	if n != 2 {
+		t.Errorf("validateUrls() = %d, want 2", n)
+	}
+	if got := lines(warnings); !reflect.DeepEqual(got, want) {
+		t.Errorf("validateUrls() reported %q, want %q", got, want)
+	}
+}
+
+func TestGroupByDate(t *testing.T) {
+	data := `{"version": 1, "roots": {"other": {"name": "Other", "type": "folder", "children": [
+		{"name": "June", "type": "url", "url": "https://a.example/", "date_added": "13300000000000000"},
+		{"name": "Undated", "type": "url", "url": "https://b.example/"},
+		{"name": "Docs", "type": "folder", "date_added": "13284820800000000", "children": [
+			{"name": "May 30", "type": "url", "url": "https://c.example/", "date_added": "13298385600000000"},
+			{"name": "December", "type": "url", "url": "https://d.example/", "date_added": "13284820800000000"}
+		]},
+		{"name": "May 3", "type": "url", "url": "https://e.example/", "date_added": "13296052800000000"}
+	]}}}`
+	tests := []struct {
+		bucket string
+		want   string
+	}{
+		{"month", "2021-12(December) 2022-05(May 30 May 3) 2022-06(June) Undated(Undated)"},
+		{"year", "2021(December) 2022(June May 30 May 3) Undated(Undated)"},
+		{"day", "2021-12-24(December) 2022-05-03(May 3) 2022-05-30(May 30) 2022-06-18(June) Undated(Undated)"},
+	}
+	for _, tt := range tests {
+		b, err := groupByDate(mustParse(t, data), tt.bucket)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := treeString(rootEntries(b)); got != tt.want {
+			t.Errorf("groupByDate(%s) = %s, want %s", tt.bucket, got, tt.want)
+		}
+	}
+	if _, err := groupByDate(mustParse(t, data), "week"); err == nil {
+		t.Error("groupByDate() succeeded for unknown bucket")
+	}
+}
+
+func TestProfilesIgnoreCase(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "Default/Bookmarks", "Profile 1/Bookmarks", "Work/Team/Bookmarks")
+	sources, err := findDirectorySources(dir, 5, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		ignoreCase bool
+		prefix     bool
+		names      []string
+		want       []string
+	}{
+		{"case sensitive", false, false, []string{"default", "Profile 1"}, []string{"Profile 1"}},
+		{"ignore case", true, false, []string{"default", "PROFILE 1"}, []string{"Default", "Profile 1"}},
+		{"ignore case prefix", true, true, []string{"work"}, []string{"Work/Team"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pf := &profilesFilter{ignoreCase: tt.ignoreCase, prefix: tt.prefix}
+			pf.add(tt.names...)
+			got := []string(nil)
+			for _, p := range sourceProfiles(sources) {
+				if pf.includes(p) {
+					got = append(got, p)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selected profiles = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMainKeepGoing(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "Default/Bookmarks", "Profile 2/Bookmarks")
+	if err := os.MkdirAll(filepath.Join(dir, "Profile 1"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "Profile 1", "Bookmarks"), []byte(`{"version": 1, "roots": `), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, code := runMain(t, "-input", dir); code != exitParse {
+		t.Errorf("exit code without --keep-going = %d, want %d", code, exitParse)
+	}
+	stdout, stderr, code := runMain(t, "-input", dir, "-keep-going")
+	if code != exitParse {
+		t.Errorf("exit code = %d, want %d", code, exitParse)
+	}
+	for _, p := range []string{"## Profile Default", "## Profile Profile 2"} {
+		if !strings.Contains(stdout, p) {
+			t.Errorf("output misses %q:\n%s", p, stdout)
+		}
+	}
+	if strings.Contains(stdout, "Profile 1") {
+		t.Errorf("output contains broken profile:\n%s", stdout)
+	}
+	if !strings.Contains(stderr, "Profile 1") || !strings.Contains(stderr, "1 bookmarks files could not be loaded") {
+		t.Errorf("stderr does not report the broken file:\n%s", stderr)
+	}
+}
+
+func TestEmptyPlaceholder(t *testing.T) {
+	empty := `{"version": 1, "roots": {"other": {"name": "Other", "type": "folder", "children": []}}}`
+	tests := []struct {
+		name        string
+		format      string
+		placeholder string
+		profiles    []string
+		want        string
+	}{
+		{"markdown empty profile", "markdown", defaultEmptyPlaceholder, []string{empty}, "## Profile P1\n- Other\n\n> _No bookmarks._\n\n"},
+		{"markdown no profiles", "markdown", defaultEmptyPlaceholder, nil, "> _No bookmarks._\n\n"},
+		{"custom text", "markdown", "Nothing here", []string{empty, testBookmarks}, "## Profile P1\n- Other\n\n> Nothing here\n\n## Profile P2\n- Bookmarks bar"},
+		{"disabled", "markdown", "", nil, "automatically generated by [chrome-bookmarks-to-markdown](https://github.com/daishe/chrome-bookmarks-to-markdown).\n\n"},
+		{"default without markup", "tree", defaultEmptyPlaceholder, []string{empty}, "Profile P1\n└── Other\n\nNo bookmarks.\n\n"},
+		{"html", "html", defaultEmptyPlaceholder, nil, "</p>\n<p>No bookmarks.</p>\n</body>\n</html>\n"},
+		{"dokuwiki", "dokuwiki", "Nothing //here//", nil, "\n\n%%Nothing //here//%%\n\n"},
+		{"not shown in json", "json-tree", defaultEmptyPlaceholder, nil, "[\n]\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profiles := []*profile(nil)
+			for i, data := range tt.profiles {
+				profiles = append(profiles, testProfile(t, fmt.Sprintf("P%d", i+1), data))
+			}
+			got := renderDocument(t, tt.format, &config{indent: "\t", baseHeadingLevel: 1, emptyPlaceholder: tt.placeholder}, profiles...)
+			if !strings.Contains(got, tt.want) || (tt.placeholder == "" && strings.Contains(got, "No bookmarks")) {
+				t.Errorf("%s output = %q, want it to contain %q", tt.format, got, tt.want)
+			}
+		})
+	}
+	pruned := testProfile(t, "Default", testBookmarks)
+	pruneBookmarks(pruned.bookmarks, isUrlEntry)
+	pruneEmptyFolders(pruned.bookmarks)
+	if !isEmptyProfile(pruned) {
+		t.Errorf("isEmptyProfile() = false for profile with all bookmarks filtered out: %s", treeString(rootEntries(pruned.bookmarks)))
+	}
+	if isEmptyProfile(testProfile(t, "Default", testBookmarks)) {
+		t.Error("isEmptyProfile() = true for profile with bookmarks")
+	}
+}
+
+func TestMatchGlobSegments(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"**/Bookmarks", "Bookmarks", true},
+		{"**/Bookmarks", "a/b/c/Bookmarks", true},
+		{"**/Bookmarks", "a/Bookmarks.bak", false},
+		{"*/Bookmarks", "a/Bookmarks", true},
+		{"*/Bookmarks", "a/b/Bookmarks", false},
+		{"2022-*/**/Default/Bookmarks", "2022-01/Users/me/Default/Bookmarks", true},
+		{"2022-*/**/Default/Bookmarks", "2021-12/Default/Bookmarks", false},
+		{"a/**", "a/b/c", true},
+		{"a/**", "a", true},
+		{"**/b/**/d", "a/b/c/d", true},
+		{"**/b/**/d", "a/c/d", false},
+		{"Profile ?/Bookmarks", "Profile 1/Bookmarks", true},
+	}
+	for _, tt := range tests {
+		if got := matchGlobSegments(strings.Split(tt.pattern, "/"), strings.Split(tt.path, "/")); got != tt.want {
+			t.Errorf("matchGlobSegments(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRecursiveGlobSources(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir,
+		"backups/2022-01/Users/me/Chrome/Default/Bookmarks",
+		"backups/2022-02/Default/Bookmarks",
+		"backups/2022-02/Default/Bookmarks.bak",
+		"backups/Bookmarks",
+		"other/Default/Bookmarks",
+	)
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"backups/**/Bookmarks", []string{"2022-01/Users/me/Chrome/Default", "2022-02/Default", "Bookmarks"}},
+		{"backups/*/Default/Bookmarks*", []string{"2022-02/Default", "2022-02/Default/Bookmarks"}},
+		{"*/**/Default/Bookmarks", []string{"backups/2022-01/Users/me/Chrome/Default", "backups/2022-02/Default", "other/Default"}},
+		{"missing/**/Bookmarks", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			sources, err := recursiveGlobSources(filepath.Join(dir, filepath.FromSlash(tt.pattern)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := sourceProfiles(sources); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("recursiveGlobSources() profiles = %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if _, err := recursiveGlobSources(filepath.Join(dir, "backups", "**", "[")); err == nil {
+		t.Error("recursiveGlobSources() succeeded for invalid pattern")
+	}
+}
+
+func TestWithTiebreak(t *testing.T) {
+	entries := []*bookmarksEntry{
+		{Name: "beta", Url: "https://a.example/", DateAdded: "13300000000000000"},
+		{Name: "Alpha", Url: "https://c.example/", DateAdded: "13300000000000000"},
+		{Name: "Old", Url: "https://z.example/", DateAdded: "13290000000000000"},
+		{Name: "alpha", Url: "https://b.example/", DateAdded: "13300000000000000"},
+	}
+	tests := []struct {
+		tiebreak      string
+		caseSensitive bool
+		want          []string
+	}{
+		{"none", false, []string{"Old", "beta", "Alpha", "alpha"}},
+		{"name", false, []string{"Old", "Alpha", "alpha", "beta"}},
+		{"name", true, []string{"Old", "Alpha", "alpha", "beta"}},
+		{"url", false, []string{"Old", "beta", "alpha", "Alpha"}},
+	}
+	for _, tt := range tests {
+		byDate, _ := entriesComparator("date", tt.caseSensitive)
+		less, err := withTiebreak(byDate, tt.tiebreak, tt.caseSensitive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sorted := append([]*bookmarksEntry(nil), entries...)
+		sort.SliceStable(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+		got := []string(nil)
+		for _, e := range sorted {
+			got = append(got, e.Name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("sorted by date with %s tiebreak = %q, want %q", tt.tiebreak, got, tt.want)
+		}
+	}
+	if less, err := withTiebreak(nil, "name", false); less != nil || err != nil {
+		t.Errorf("withTiebreak(nil) = %v, %v, want nil comparator", less != nil, err)
+	}
+	if _, err := withTiebreak(nil, "size", false); err == nil {
+		t.Error("withTiebreak() succeeded for unknown tiebreak")
+	}
+}
+
+func TestVersionBanner(t *testing.T) {
+	version, commit := Version, Commit
+	defer func() { Version, Commit = version, commit }()
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{"1.2.3", "Generated by chrome-bookmarks-to-markdown v1.2.3 (commit abc)."},
+		{"v1.2.3", "Generated by chrome-bookmarks-to-markdown v1.2.3 (commit abc)."},
+		{"development", "Generated by chrome-bookmarks-to-markdown development (commit abc)."},
+	}
+	for _, tt := range tests {
+		Version, Commit = tt.version, "abc"
+		if got := versionBanner(); got != tt.want {
+			t.Errorf("versionBanner() with version %q = %q, want %q", tt.version, got, tt.want)
+		}
+	}
+
+	Version, Commit = "1.2.3", "abc"
+	got := renderDocument(t, "markdown", &config{indent: "\t", baseHeadingLevel: 1, bannerLines: []string{versionBanner()}})
+	if want := ".\n>\n> Generated by chrome-bookmarks-to-markdown v1.2.3 (commit abc).\n\n"; !strings.Contains(got, want) {
+		t.Errorf("markdown banner = %q, want it to contain %q", got, want)
+	}
+}
+
+func TestDedupeShortest(t *testing.T) {
+	data := `{"version": 1, "roots": {"other": {"name": "Other", "type": "folder", "children": [
+		{"name": "Go docs", "type": "url", "url": "https://go.dev/doc/?utm_source=news&utm_medium=email"},
+		{"name": "Docs", "type": "folder", "children": [
+			{"name": "Go docs", "type": "url", "url": "https://go.dev/doc/"},
+			{"name": "Go docs", "type": "url", "url": "https://go.dev/doc/?ref=a"}
+		]},
+		{"name": "A", "type": "url", "url": "https://a.example/1"},
+		{"name": "A", "type": "url", "url": "https://a.example/2"}
+	]}}}`
+	b := mustParse(t, data)
+	if err := dedupeBookmarks(b, "shortest", "title", false); err != nil {
+		t.Fatal(err)
+	}
+	got := []string(nil)
+	walkBookmarks(b, func(e *bookmarksEntry, depth int) {
+		if isUrlEntry(e) {
+			got = append(got, e.Url)
+		}
+	})
+	if want := []string{"https://go.dev/doc/", "https://a.example/1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("dedupeBookmarks(shortest) kept %q, want %q", got, want)
+	}
+}
+
+func TestDedupeShortestUrl(t *testing.T) {
+	data := `{"version": 1, "roots": {"other": {"name": "Other", "type": "folder", "children": [
+		{"name": "Go docs (newsletter)", "type": "url", "url": "https://go.dev/doc/?utm_source=news&utm_medium=email#install"},
+		{"name": "Go docs", "type": "url", "url": "https://go.dev/doc"},
+		{"name": "Go docs again", "type": "url", "url": "https://go.dev/doc/?ref=a"},
+		{"name": "Tour", "type": "url", "url": "https://go.dev/tour/?utm_source=x"},
+		{"name": "Blog", "type": "url", "url": "https://go.dev/blog/"}
+	]}}}`
+	b := mustParse(t, data)
+	if err := dedupeBookmarks(b, "shortest", "url", false); err != nil {
+		t.Fatal(err)
+	}
+	got := []string(nil)
+	walkBookmarks(b, func(e *bookmarksEntry, depth int) {
+		if isUrlEntry(e) {
+			got = append(got, e.Url)
+		}
+	})
+	if want := []string{"https://go.dev/doc", "https://go.dev/tour/?utm_source=x", "https://go.dev/blog/"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("dedupeBookmarks(shortest) kept %q, want %q", got, want)
+	}
+}
+
+func TestMaxRenderDepth(t *testing.T) {
+	tests := []struct {
+		depth int
+		want  string
+	}{
+		{0, "- Other\n  - F1\n    - F2\n      - F3\n        - [Go](https://go.dev/)\n"},
+		{1, "- Other\n- F1\n- F2\n- F3\n- [Go](https://go.dev/)\n"},
+		{2, "- Other\n  - F1\n  - F2\n  - F3\n  - [Go](https://go.dev/)\n"},
+		{3, "- Other\n  - F1\n    - F2\n    - F3\n    - [Go](https://go.dev/)\n"},
+		{10, "- Other\n  - F1\n    - F2\n      - F3\n        - [Go](https://go.dev/)\n"},
+	}
+	for _, tt := range tests {
+		root := &bookmarksEntry{Name: "Other", Type: "folder", Children: []*bookmarksEntry{nested(3)}}
+		p := &profile{name: "Default", bookmarks: &bookmarks{Roots: map[string]*bookmarksEntry{"other": root}}}
+		got := renderProfile(t, "markdown", &config{indent: "  ", baseHeadingLevel: 1, maxRenderDepth: tt.depth}, p)
+		if want := "## Profile Default\n" + tt.want + "\n"; got != want {
+			t.Errorf("markdown output with max render depth %d = %q, want %q", tt.depth, got, want)
+		}
+	}
+}
+
+func TestDomainStats(t *testing.T) {
+	profiles := []*profile{testProfile(t, "A", testBookmarks), testProfile(t, "B", dupBookmarks)}
+	want := []domainCount{{"a.example", 3}, {"go.dev", 2}, {"(no host)", 1}, {"b.example", 1}, {"www.example.com", 1}}
+	if got := domainStats(profiles, false); !reflect.DeepEqual(got, want) {
+		t.Errorf("domainStats() = %v, want %v", got, want)
+	}
+	want[4].Domain = "example.com"
+	if got := domainStats(profiles, true); !reflect.DeepEqual(got, want) {
+		t.Errorf("domainStats(stripWww) = %v, want %v", got, want)
+	}
+}
+
+func TestWriteDomainStats(t *testing.T) {
+	stats := []domainCount{{"a.example", 3}, {"go.dev", 2}, {"(no host)", 1}}
+	tests := []struct {
+		name   string
+		stats  []domainCount
+		format string
+		want   string
+	}{
+		{"markdown", stats, "markdown", "# Bookmarks by domain\n\n| Domain | Bookmarks |\n|--------|-----------|\n| a.example | 3 |\n| go.dev | 2 |\n| (no host) | 1 |\n"},
+		{"csv", stats, "csv", "domain,bookmarks\na.example,3\ngo.dev,2\n(no host),1\n"},
+		{"empty", nil, "markdown", "# Bookmarks by domain\n\nNo bookmarks found.\n"},
+		{"empty csv", nil, "csv", "domain,bookmarks\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &strings.Builder{}
+			if err := writeDomainStats(out, tt.stats, tt.format); err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("writeDomainStats() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInputPaths(t *testing.T) {
+	dir := t.TempDir()
+	withComma := filepath.Join(dir, "a,b")
+	if err := os.Mkdir(withComma, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"profiles", []string{"profiles"}},
+		{"a,b", []string{"a", "b"}},
+		{" a , ,b/ ", []string{"a", "b"}},
+		{withComma, []string{withComma}},
+	}
+	for _, tt := range tests {
+		if got := inputPaths(tt.input); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("inputPaths(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestFindInputsSources(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "home/Default/Bookmarks", "home/Profile 1/Bookmarks", "backup/Default/Bookmarks", "x/same/Default/Bookmarks", "y/same/Default/Bookmarks")
+	path := func(p string) string { return filepath.Join(dir, filepath.FromSlash(p)) }
+	tests := []struct {
+		name    string
+		paths   []string
+		want    []string
+		wantErr bool
+	}{
+		{"single path", []string{path("home")}, []string{"Default", "Profile 1"}, false},
+		{"two roots", []string{path("home"), path("backup")}, []string{"home/Default", "home/Profile 1", "backup/Default"}, false},
+		{"nested paths", []string{path("home"), path("home/Default")}, []string{"home/Default", "home/Profile 1"}, false},
+		{"repeated path", []string{path("backup"), path("backup")}, []string{"backup/Default"}, false},
+		{"shared base names", []string{path("x/same"), path("y/same")}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sources, err := findInputsSources(tt.paths, 5, false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("findInputsSources() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := sourceProfiles(sources); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findInputsSources() profiles = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripEmoji(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"🚀 Launch", "Launch"},
+		{"Go 🎉 docs", "Go docs"},
+		{"Done ✓", "Done"},
+		{"❤️ Love", "Love"},
+		{"👨‍👩‍👧 Family", "Family"},
+		{"Flag 🇵🇱 trip", "Flag trip"},
+		{"1️⃣ One", "1 One"},
+		{"C++ ★★★", "C++"},
+		{"Café – 日本語", "Café – 日本語"},
+		{"a  b", "a  b"},
+		{"🔥🔥", ""},
+	}
+	for _, tt := range tests {
+		if got := stripEmoji(tt.name); got != tt.want {
+			t.Errorf("stripEmoji(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
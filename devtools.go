@@ -0,0 +1,230 @@
+// Copyright 2022 Marek Dalewski
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// devtoolsUserDataDir asks Chrome running with remote debugging enabled
+// (--remote-debugging-port) about its command line and returns its user data
+// directory. DevTools protocol does not give access to bookmarks, so they are
+// read from the reported directory afterwards. Chrome reports its command line
+// only when started with --enable-automation. When no --user-data-dir switch
+// is present, default Chrome configuration location is returned.
+func devtoolsUserDataDir(devtoolsUrl string, timeout time.Duration) (string, error) {
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(strings.TrimSuffix(devtoolsUrl, "/") + "/json/version")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", &exitError{exitIO, fmt.Errorf("querying DevTools at %s: unexpected response status %s", devtoolsUrl, resp.Status)}
+	}
+	version := struct {
+		WebSocketDebuggerUrl string `json:"webSocketDebuggerUrl"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&version); err != nil {
+		return "", fmt.Errorf("querying DevTools at %s: %w", devtoolsUrl, err)
+	}
+	if version.WebSocketDebuggerUrl == "" {
+		return "", fmt.Errorf("querying DevTools at %s: no browser debugger URL reported", devtoolsUrl)
+	}
+
+	res := struct {
+		Result struct {
+			Arguments []string `json:"arguments"`
+		} `json:"result"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}{}
+	if err := devtoolsCall(version.WebSocketDebuggerUrl, "Browser.getBrowserCommandLine", timeout, &res); err != nil {
+		return "", err
+	}
+	if res.Error != nil {
+		return "", fmt.Errorf("reading Chrome command line through DevTools: %s (is Chrome started with --enable-automation?)", res.Error.Message)
+	}
+	for _, a := range res.Result.Arguments {
+		if strings.HasPrefix(a, "--user-data-dir=") {
+			return strings.TrimPrefix(a, "--user-data-dir="), nil
+		}
+	}
+	return defaultChromeConfigLocation()
+}
+
+// devtoolsCall sends a single DevTools protocol command over WebSocket and
+// decodes its response into res.
+func devtoolsCall(wsUrl, method string, timeout time.Duration, res interface{}) error {
+	u, err := url.Parse(wsUrl)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "ws" {
+		return fmt.Errorf("unsupported DevTools debugger URL %s", wsUrl)
+	}
+	conn, err := net.DialTimeout("tcp", u.Host, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(conn)
+	if err := websocketHandshake(conn, r, u); err != nil {
+		return err
+	}
+	msg, err := json.Marshal(map[string]interface{}{"id": 1, "method": method})
+	if err != nil {
+		return err
+	}
+	if err := websocketWrite(conn, msg); err != nil {
+		return err
+	}
+	for {
+		data, err := websocketRead(r)
+		if err != nil {
+			return err
+		}
+		id := struct {
+			Id int `json:"id"`
+		}{}
+		if json.Unmarshal(data, &id) == nil && id.Id == 1 {
+			return json.Unmarshal(data, res)
+		}
+	}
+}
+
+const websocketGuid = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+func websocketHandshake(w io.Writer, r *bufio.Reader, u *url.URL) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+	req := fmt.Sprintf("GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n\r\n", u.RequestURI(), u.Host, key)
+	if _, err := io.WriteString(w, req); err != nil {
+		return err
+	}
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	sum := sha1.Sum([]byte(key + websocketGuid))
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) {
+		return fmt.Errorf("DevTools WebSocket handshake failed: %s", resp.Status)
+	}
+	return nil
+}
+
+// websocketWrite writes a single masked text frame.
+func websocketWrite(w io.Writer, payload []byte) error {
+	frame := []byte{0x81}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, 0x80|byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 0x80|126, byte(n>>8), byte(n))
+	default:
+		b := [8]byte{}
+		binary.BigEndian.PutUint64(b[:], uint64(n))
+		frame = append(append(frame, 0x80|127), b[:]...)
+	}
+	mask := make([]byte, 4)
+	if _, err := rand.Read(mask); err != nil {
+		return err
+	}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	_, err := w.Write(frame)
+	return err
+}
+
+// websocketRead reads a single (possibly fragmented) data message, skipping
+// control frames.
+func websocketRead(r *bufio.Reader) ([]byte, error) {
+	msg := []byte(nil)
+	for {
+		head := make([]byte, 2)
+		if _, err := io.ReadFull(r, head); err != nil {
+			return nil, err
+		}
+		fin, opcode := head[0]&0x80 != 0, head[0]&0x0f
+		n := uint64(head[1] & 0x7f)
+		switch n {
+		case 126:
+			b := make([]byte, 2)
+			if _, err := io.ReadFull(r, b); err != nil {
+				return nil, err
+			}
+			n = uint64(binary.BigEndian.Uint16(b))
+		case 127:
+			b := make([]byte, 8)
+			if _, err := io.ReadFull(r, b); err != nil {
+				return nil, err
+			}
+			n = binary.BigEndian.Uint64(b)
+		}
+		mask := []byte(nil)
+		if head[1]&0x80 != 0 {
+			mask = make([]byte, 4)
+			if _, err := io.ReadFull(r, mask); err != nil {
+				return nil, err
+			}
+		}
+		if n > 64<<20 {
+			return nil, errors.New("DevTools WebSocket message too large")
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return nil, err
+		}
+		for i := range payload {
+			if mask != nil {
+				payload[i] ^= mask[i%4]
+			}
+		}
+		if opcode == 0x8 {
+			return nil, errors.New("DevTools WebSocket connection closed")
+		}
+		if opcode >= 0x8 {
+			continue // ping and pong
+		}
+		msg = append(msg, payload...)
+		if fin {
+			return msg, nil
+		}
+	}
+}
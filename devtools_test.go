@@ -0,0 +1,159 @@
+// Copyright 2022 Marek Dalewski
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebsocketRoundtrip(t *testing.T) {
+	tests := []struct {
+		size     int
+		lenBytes int // bytes of the frame header used for payload length
+	}{
+		{0, 1},
+		{125, 1},
+		{126, 3},
+		{0xffff, 3},
+		{0x10000, 9},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.size), func(t *testing.T) {
+			payload := bytes.Repeat([]byte("x"), tt.size)
+			buf := &bytes.Buffer{}
+			if err := websocketWrite(buf, payload); err != nil {
+				t.Fatal(err)
+			}
+			frame := buf.Bytes()
+			if frame[0] != 0x81 || frame[1]&0x80 == 0 {
+				t.Errorf("websocketWrite() header % x, want final masked text frame", frame[:2])
+			}
+			if got, want := len(frame), 1+tt.lenBytes+4+tt.size; got != want {
+				t.Errorf("websocketWrite() frame size = %d, want %d", got, want)
+			}
+			got, err := websocketRead(bufio.NewReader(buf))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, payload) {
+				t.Errorf("websocketRead() returned %d bytes, want %d", len(got), len(payload))
+			}
+		})
+	}
+}
+
+func TestWebsocketRead(t *testing.T) {
+	tests := []struct {
+		name    string
+		frames  []byte
+		want    string
+		wantErr bool
+	}{
+		{"unmasked", []byte{0x81, 2, 'o', 'k'}, "ok", false},
+		{"fragmented", []byte{0x01, 2, 'a', 'b', 0x80, 1, 'c'}, "abc", false},
+		{"control frames skipped", []byte{0x89, 0, 0x01, 1, 'a', 0x8a, 0, 0x80, 1, 'b'}, "ab", false},
+		{"masked", []byte{0x81, 0x82, 1, 2, 3, 4, 'o' ^ 1, 'k' ^ 2}, "ok", false},
+		{"close", []byte{0x88, 0}, "", true},
+		{"too large", []byte{0x81, 127, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, "", true},
+		{"truncated", []byte{0x81, 5, 'a'}, "", true},
+		{"empty", nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := websocketRead(bufio.NewReader(bytes.NewReader(tt.frames)))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("websocketRead() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("websocketRead() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// devtoolsServer returns server acting as Chrome DevTools endpoint, which
+// answers the first WebSocket message with an unrelated event followed by the
+// given response.
+func devtoolsServer(t *testing.T, response string) *httptest.Server {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/json/version":
+			fmt.Fprintf(w, `{"Browser": "Chrome/100.0", "webSocketDebuggerUrl": "ws://%s/devtools/browser/1"}`, strings.TrimPrefix(srv.URL, "http://"))
+		case "/devtools/browser/1":
+			conn, rw, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer conn.Close()
+			sum := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + websocketGuid))
+			fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", base64.StdEncoding.EncodeToString(sum[:]))
+			rw.Flush()
+			if _, err := websocketRead(rw.Reader); err != nil {
+				t.Error(err)
+				return
+			}
+			rw.Write([]byte{0x81, 0x05, '{', '}', ' ', ' ', ' '}) // event without id
+			rw.Write(append([]byte{0x81, byte(len(response))}, response...))
+			rw.Flush()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return srv
+}
+
+func TestDevtoolsUserDataDir(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     string
+		wantErr  bool
+	}{
+		{"user data dir", `{"id": 1, "result": {"arguments": ["chrome", "--enable-automation", "--user-data-dir=/tmp/chrome"]}}`, "/tmp/chrome", false},
+		{"protocol error", `{"id": 1, "error": {"message": "Browser.getBrowserCommandLine is only supported with --enable-automation"}}`, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := devtoolsServer(t, tt.response)
+			defer srv.Close()
+			got, err := devtoolsUserDataDir(srv.URL, 5*time.Second)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("devtoolsUserDataDir() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("devtoolsUserDataDir() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDevtoolsUserDataDirNotFound(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	if _, err := devtoolsUserDataDir(srv.URL, 5*time.Second); exitCode(err) != exitIO {
+		t.Errorf("devtoolsUserDataDir() error = %v, want exit code %d", err, exitIO)
+	}
+}
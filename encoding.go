@@ -0,0 +1,109 @@
+// Copyright 2022 Marek Dalewski
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+var outputEncodings = []string{"utf-8", "utf-16le", "utf-16be", "windows-1252"}
+
+// windows1252 maps code points to bytes for the 0x80-0x9f range of Windows-1252
+// code page. Remaining bytes map directly to code points U+0000-U+00FF.
+var windows1252 = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87,
+	'ˆ': 0x88, '‰': 0x89, 'Š': 0x8a, '‹': 0x8b, 'Œ': 0x8c, 'Ž': 0x8e,
+	'‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97,
+	'˜': 0x98, '™': 0x99, 'š': 0x9a, '›': 0x9b, 'œ': 0x9c, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+// encodeOutput wraps writer so that UTF-8 text written to it is converted to
+// the given encoding.
+func encodeOutput(w WriteSyncCloser, encoding string) (WriteSyncCloser, error) {
+	switch strings.ToLower(encoding) {
+	case "utf-8", "utf8", "":
+		return w, nil
+	case "utf-16le":
+		return &encodingWriter{WriteSyncCloser: w, name: "utf-16le", encode: encodeUtf16(binary.LittleEndian)}, nil
+	case "utf-16be":
+		return &encodingWriter{WriteSyncCloser: w, name: "utf-16be", encode: encodeUtf16(binary.BigEndian)}, nil
+	case "windows-1252", "cp1252":
+		return &encodingWriter{WriteSyncCloser: w, name: "windows-1252", encode: encodeWindows1252}, nil
+	default:
+		return nil, fmt.Errorf("unknown output encoding %q, expected one of: %s", encoding, strings.Join(outputEncodings, ", "))
+	}
+}
+
+func encodeUtf16(order binary.ByteOrder) func(dst []byte, r rune) ([]byte, bool) {
+	return func(dst []byte, r rune) ([]byte, bool) {
+		for _, u := range utf16.Encode([]rune{r}) {
+			b := [2]byte{}
+			order.PutUint16(b[:], u)
+			dst = append(dst, b[:]...)
+		}
+		return dst, true
+	}
+}
+
+func encodeWindows1252(dst []byte, r rune) ([]byte, bool) {
+	if b, ok := windows1252[r]; ok {
+		return append(dst, b), true
+	}
+	if r < 0x80 || (r >= 0xa0 && r <= 0xff) {
+		return append(dst, byte(r)), true
+	}
+	return append(dst, '?'), false
+}
+
+// encodingWriter converts UTF-8 text to other encoding. Characters that cannot
+// be represented are replaced and reported as warnings, once per character.
+type encodingWriter struct {
+	WriteSyncCloser
+	name     string
+	encode   func(dst []byte, r rune) ([]byte, bool)
+	pending  []byte // incomplete UTF-8 sequence from the previous write
+	reported map[rune]bool
+}
+
+func (ew *encodingWriter) Write(p []byte) (int, error) {
+	data := append(ew.pending, p...)
+	ew.pending = nil
+	out := make([]byte, 0, len(data)*2)
+	for len(data) > 0 {
+		if !utf8.FullRune(data) {
+			ew.pending = append([]byte(nil), data...)
+			break
+		}
+		r, size := utf8.DecodeRune(data)
+		data = data[size:]
+		var ok bool
+		out, ok = ew.encode(out, r)
+		if !ok && !ew.reported[r] {
+			if ew.reported == nil {
+				ew.reported = map[rune]bool{}
+			}
+			ew.reported[r] = true
+			reportWarning(fmt.Sprintf("character %q cannot be represented in %s output encoding and has been replaced", r, ew.name))
+		}
+	}
+	if _, err := ew.WriteSyncCloser.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
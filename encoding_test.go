@@ -0,0 +1,90 @@
+// Copyright 2022 Marek Dalewski
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestEncodeOutput(t *testing.T) {
+	tests := []struct {
+		encoding string
+		input    string
+		want     []byte
+		warnings []string
+	}{
+		{"utf-8", "zażółć", []byte("zażółć"), nil},
+		{"UTF8", "€", []byte("€"), nil},
+		{"", "€", []byte("€"), nil},
+		{"utf-16le", "Aż", []byte{'A', 0, 0x7c, 0x01}, nil},
+		{"utf-16be", "Aż", []byte{0, 'A', 0x01, 0x7c}, nil},
+		{"utf-16le", "😀", []byte{0x3d, 0xd8, 0x00, 0xde}, nil},
+		{"windows-1252", "café €5 “x”", []byte{'c', 'a', 'f', 0xe9, ' ', 0x80, '5', ' ', 0x93, 'x', 0x94}, nil},
+		{"cp1252", "a b", []byte{'a', 0xa0, 'b'}, nil},
+		{
+			"windows-1252", "żółw ż Ω",
+			[]byte{'?', 0xf3, '?', 'w', ' ', '?', ' ', '?'},
+			[]string{
+				`Warning: character 'ż' cannot be represented in windows-1252 output encoding and has been replaced`,
+				`Warning: character 'ł' cannot be represented in windows-1252 output encoding and has been replaced`,
+				`Warning: character 'Ω' cannot be represented in windows-1252 output encoding and has been replaced`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoding+" "+tt.input, func(t *testing.T) {
+			out := &bufferOutput{}
+			w, err := encodeOutput(out, tt.encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			warnings := captureStderr(t, func() {
+				if _, err := w.Write([]byte(tt.input)); err != nil {
+					t.Fatal(err)
+				}
+			})
+			if got := out.Bytes(); !bytes.Equal(got, tt.want) {
+				t.Errorf("encodeOutput() wrote % x, want % x", got, tt.want)
+			}
+			if got := lines(warnings); !reflect.DeepEqual(got, tt.warnings) {
+				t.Errorf("encodeOutput() reported %q, want %q", got, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestEncodeOutputSplitCharacter(t *testing.T) {
+	out := &bufferOutput{}
+	w, err := encodeOutput(out, "utf-16be")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range [][]byte{{'a', 0xc5}, {0xbc}, {'b'}} { // "ażb" split inside "ż"
+		if n, err := w.Write(p); err != nil || n != len(p) {
+			t.Fatalf("Write(% x) = %d, %v", p, n, err)
+		}
+	}
+	if got, want := out.Bytes(), []byte{0, 'a', 0x01, 0x7c, 0, 'b'}; !bytes.Equal(got, want) {
+		t.Errorf("encodeOutput() wrote % x, want % x", got, want)
+	}
+}
+
+func TestEncodeOutputUnknown(t *testing.T) {
+	if _, err := encodeOutput(&bufferOutput{}, "latin-2"); err == nil {
+		t.Error("encodeOutput() succeeded for unknown encoding")
+	}
+}
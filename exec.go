@@ -0,0 +1,148 @@
+// Copyright 2022 Marek Dalewski
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// limiter bounds the number of operations in progress, across all features
+// doing work concurrently. Nil limiter does not limit anything.
+type limiter chan struct{}
+
+// newLimiter returns limiter allowing at most n operations at once, or nil for
+// n equal to 0.
+func newLimiter(n int) limiter {
+	if n == 0 {
+		return nil
+	}
+	return make(limiter, n)
+}
+
+func (l limiter) acquire() {
+	if l != nil {
+		l <- struct{}{}
+	}
+}
+
+func (l limiter) release() {
+	if l != nil {
+		<-l
+	}
+}
+
+// execCommand holds external command run for every bookmark.
+type execCommand struct {
+	args        []string
+	concurrency int
+	timeout     time.Duration
+	annotate    bool    // record outcome in entries, to be shown in output
+	shared      limiter // global limit of concurrent operations
+}
+
+// parseExecCommand splits command into arguments. The command is not passed to
+// a shell, arguments are separated with white space.
+func parseExecCommand(command string, concurrency int, timeout time.Duration, annotate bool) (*execCommand, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, errors.New("exec command must not be empty")
+	}
+	if concurrency < 1 {
+		return nil, fmt.Errorf("exec concurrency must be positive, got %d", concurrency)
+	}
+	return &execCommand{args: args, concurrency: concurrency, timeout: timeout, annotate: annotate}, nil
+}
+
+// commandArgs returns arguments of the command run for the given URL. Every
+// {} placeholder is replaced with the URL. Without placeholders the URL is
+// appended as the last argument.
+func (c *execCommand) commandArgs(rawUrl string) []string {
+	res, replaced := make([]string, 0, len(c.args)+1), false
+	for _, a := range c.args {
+		if strings.Contains(a, "{}") {
+			a, replaced = strings.ReplaceAll(a, "{}", rawUrl), true
+		}
+		res = append(res, a)
+	}
+	if !replaced {
+		res = append(res, rawUrl)
+	}
+	return res
+}
+
+// run executes the command for every bookmark of the given profiles, running
+// at most concurrency commands at once. Output of commands goes to stderr.
+// Returns number of failed runs.
+func (c *execCommand) run(profiles []*profile) int {
+	entries := []*bookmarksEntry(nil)
+	for _, p := range profiles {
+		walkBookmarks(p.bookmarks, func(e *bookmarksEntry, depth int) {
+			if isUrlEntry(e) && e.Url != "" {
+				entries = append(entries, e)
+			}
+		})
+	}
+
+	mu, failed := sync.Mutex{}, 0
+	wg, sem := sync.WaitGroup{}, make(chan struct{}, c.concurrency)
+	for _, e := range entries {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(e *bookmarksEntry) {
+			defer func() { <-sem; wg.Done() }()
+			c.shared.acquire()
+			err := c.runOne(e.Url)
+			c.shared.release()
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed++
+				reportWarning(fmt.Sprintf("exec for %s failed: %v", e.Url, err))
+			}
+			if c.annotate {
+				e.execResult = "exec: ok"
+				if err != nil {
+					e.execResult = "exec: failed"
+				}
+			}
+		}(e)
+	}
+	wg.Wait()
+	return failed
+}
+
+func (c *execCommand) runOne(rawUrl string) error {
+	ctx := context.Background()
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	args := c.commandArgs(rawUrl)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s", c.timeout)
+	}
+	return err
+}
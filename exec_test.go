@@ -0,0 +1,184 @@
+// Copyright 2022 Marek Dalewski
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func init() {
+	// exec helper fails for URLs containing "fail" and sleeps for URLs
+	// containing "slow".
+	testHelpers["exec"] = func() {
+		u := os.Args[len(os.Args)-1]
+		if strings.Contains(u, "slow") {
+			time.Sleep(10 * time.Second)
+		}
+		if strings.Contains(u, "fail") {
+			os.Exit(1)
+		}
+	}
+}
+
+// helperCommand returns command running exec helper of the test binary.
+func helperCommand(t *testing.T, timeout time.Duration, annotate bool) *execCommand {
+	t.Setenv("CBM_TEST_HELPER", "exec")
+	return &execCommand{args: []string{os.Args[0]}, concurrency: 2, timeout: timeout, annotate: annotate}
+}
+
+func TestParseExecCommand(t *testing.T) {
+	tests := []struct {
+		command     string
+		concurrency int
+		want        []string
+		wantErr     bool
+	}{
+		{"open", 1, []string{"open"}, false},
+		{"  curl  -sI   {} ", 4, []string{"curl", "-sI", "{}"}, false},
+		{"", 1, nil, true},
+		{"   ", 1, nil, true},
+		{"open", 0, nil, true},
+	}
+	for _, tt := range tests {
+		c, err := parseExecCommand(tt.command, tt.concurrency, time.Second, false)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseExecCommand(%q, %d) error = %v, wantErr %v", tt.command, tt.concurrency, err, tt.wantErr)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(c.args, tt.want) {
+			t.Errorf("parseExecCommand(%q) args = %q, want %q", tt.command, c.args, tt.want)
+		}
+	}
+}
+
+func TestCommandArgs(t *testing.T) {
+	const u = "https://go.dev/"
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"open"}, []string{"open", u}},
+		{[]string{"curl", "{}", "-o", "out"}, []string{"curl", u, "-o", "out"}},
+		{[]string{"echo", "url={}", "{}"}, []string{"echo", "url=" + u, u}},
+	}
+	for _, tt := range tests {
+		c := &execCommand{args: tt.args}
+		if got := c.commandArgs(u); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("commandArgs() with %q = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestExecCommandRun(t *testing.T) {
+	data := `{"version": 1, "roots": {"other": {"name": "Other", "type": "folder", "children": [
+		{"name": "A", "type": "url", "url": "https://a.example/"},
+		{"name": "Fail", "type": "url", "url": "https://fail.example/"},
+		{"name": "Empty", "type": "url", "url": ""},
+		{"name": "B", "type": "url", "url": "https://b.example/"}
+	]}}}`
+	tests := []struct {
+		name     string
+		annotate bool
+		want     []string
+	}{
+		{"without annotations", false, []string{"", "", "", ""}},
+		{"with annotations", true, []string{"exec: ok", "exec: failed", "", "exec: ok"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := testProfile(t, "Default", data)
+			failed := 0
+			warnings := captureStderr(t, func() { failed = helperCommand(t, 0, tt.annotate).run([]*profile{p}) })
+			if failed != 1 {
+				t.Errorf("run() = %d failures, want 1", failed)
+			}
+			if got := lines(warnings); len(got) != 1 || !strings.HasPrefix(got[0], "Warning: exec for https://fail.example/ failed: ") {
+				t.Errorf("run() reported %q, want single failure of https://fail.example/", got)
+			}
+			got := []string{}
+			for _, e := range p.bookmarks.Roots["other"].Children {
+				got = append(got, e.execResult)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("run() results = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecCommandTimeout(t *testing.T) {
+	data := `{"version": 1, "roots": {"other": {"name": "Other", "type": "folder", "children": [
+		{"name": "Slow", "type": "url", "url": "https://slow.example/"}
+	]}}}`
+	failed := 0
+	warnings := captureStderr(t, func() {
+		failed = helperCommand(t, 100*time.Millisecond, false).run([]*profile{testProfile(t, "Default", data)})
+	})
+	if failed != 1 || !strings.Contains(warnings, "timed out after 100ms") {
+		t.Errorf("run() = %d failures, reported %q, want timeout", failed, warnings)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	tests := []struct {
+		limit   int
+		workers int
+		want    int32 // allowed number of operations in progress
+	}{
+		{1, 8, 1},
+		{3, 16, 3},
+		{4, 2, 2},
+		{0, 5, 5},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.limit), func(t *testing.T) {
+			l := newLimiter(tt.limit)
+			if (l == nil) != (tt.limit == 0) {
+				t.Fatalf("newLimiter(%d) = %v", tt.limit, l)
+			}
+			var inFlight, peak int32
+			start := make(chan struct{})
+			wg := &sync.WaitGroup{}
+			for i := 0; i < tt.workers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					<-start
+					for j := 0; j < 5; j++ {
+						l.acquire()
+						n := atomic.AddInt32(&inFlight, 1)
+						for m := atomic.LoadInt32(&peak); n > m && !atomic.CompareAndSwapInt32(&peak, m, n); m = atomic.LoadInt32(&peak) {
+						}
+						time.Sleep(2 * time.Millisecond)
+						atomic.AddInt32(&inFlight, -1)
+						l.release()
+					}
+				}()
+			}
+			close(start)
+			wg.Wait()
+			if peak > tt.want {
+				t.Errorf("%d operations were in progress at once, want at most %d", peak, tt.want)
+			}
+		})
+	}
+}
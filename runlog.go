@@ -0,0 +1,93 @@
+// Copyright 2022 Marek Dalewski
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// runLog collects information about the current run, appended to the file
+// given with --log-file. It is nil when no log file is requested.
+var runLog *runRecord
+
+type runRecord struct {
+	path      string
+	started   time.Time
+	input     string
+	profiles  []string
+	bookmarks int
+	errors    []string
+	written   bool
+}
+
+func (r *runRecord) setInput(input string) {
+	if r != nil {
+		r.input = input
+	}
+}
+
+func (r *runRecord) setProfiles(profiles []*profile) {
+	if r == nil {
+		return
+	}
+	r.profiles, r.bookmarks = nil, 0
+	for _, p := range profiles {
+		r.profiles = append(r.profiles, p.name)
+		r.bookmarks += countBookmarks(p.bookmarks)
+	}
+}
+
+func (r *runRecord) addError(err interface{}) {
+	if r != nil {
+		r.errors = append(r.errors, fmt.Sprint(err))
+	}
+}
+
+// discard drops the record, so that nothing is written for the current run.
+func (r *runRecord) discard() {
+	if r != nil {
+		r.written = true
+	}
+}
+
+// write appends a single line describing the run to the log file. The file is
+// opened in append mode and the line is written at once, so that runs started
+// concurrently (like from cron) do not mix their entries. Only the first call
+// writes anything.
+func (r *runRecord) write(code int) {
+	if r == nil || r.written {
+		return
+	}
+	r.written = true
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "%s input=%q profiles=%q bookmarks=%d duration=%s exit=%d", r.started.UTC().Format(time.RFC3339), r.input, strings.Join(r.profiles, ","), r.bookmarks, time.Since(r.started).Round(time.Millisecond), code)
+	if len(r.errors) != 0 {
+		fmt.Fprintf(sb, " errors=%q", strings.Join(r.errors, "; "))
+	}
+	sb.WriteString("\n")
+
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		reportWarning(fmt.Sprintf("writing log file: %v", err))
+		return
+	}
+	defer f.Close()
+	if _, err := f.WriteString(sb.String()); err != nil {
+		reportWarning(fmt.Sprintf("writing log file: %v", err))
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2022 Marek Dalewski
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunRecordWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "runs.log")
+	if err := os.WriteFile(path, []byte("previous run\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	started := time.Date(2022, 6, 18, 4, 26, 40, 0, time.UTC)
+
+	r := &runRecord{path: path, started: started}
+	r.setInput("/home/user/.config/google-chrome")
+	r.setProfiles([]*profile{testProfile(t, "Default", testBookmarks), testProfile(t, "Profile 1", specialBookmarks)})
+	r.addError(errors.New("bookmarks file Bookmarks: unexpected end of JSON input"))
+	r.write(exitParse)
+	r.write(0) // only the first call writes
+
+	ok := &runRecord{path: path, started: started}
+	ok.setInput("Bookmarks")
+	ok.write(0)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	want := []*regexp.Regexp{
+		regexp.MustCompile(`^previous run$`),
+		regexp.MustCompile(`^2022-06-18T04:26:40Z input="/home/user/.config/google-chrome" profiles="Default,Profile 1" bookmarks=4 duration=\S+ exit=3 errors="bookmarks file Bookmarks: unexpected end of JSON input"$`),
+		regexp.MustCompile(`^2022-06-18T04:26:40Z input="Bookmarks" profiles="" bookmarks=0 duration=\S+ exit=0$`),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("log file has %d lines, want %d:\n%s", len(got), len(want), data)
+	}
+	for i, re := range want {
+		if !re.MatchString(got[i]) {
+			t.Errorf("log line %d = %q, want match of %s", i+1, got[i], re)
+		}
+	}
+}
+
+func TestRunRecordDiscard(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "runs.log")
+	r := &runRecord{path: path, started: time.Now()}
+	r.discard()
+	r.write(0)
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("discarded record created log file, stat error = %v", err)
+	}
+}
+
+func TestRunRecordNil(t *testing.T) {
+	var r *runRecord
+	r.setInput("Bookmarks")
+	r.setProfiles([]*profile{testProfile(t, "Default", testBookmarks)})
+	r.addError(errors.New("failed"))
+	r.discard()
+	r.write(0)
+}
+
+func TestRunRecordWriteError(t *testing.T) {
+	r := &runRecord{path: filepath.Join(t.TempDir(), "missing", "runs.log"), started: time.Now()}
+	stderr := captureStderr(t, func() { r.write(0) })
+	if !strings.HasPrefix(stderr, "Warning: writing log file: ") {
+		t.Errorf("write() reported %q, want warning about log file", stderr)
+	}
+}
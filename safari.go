@@ -0,0 +1,417 @@
+// Copyright 2022 Marek Dalewski
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+func defaultSafariBookmarksLocation() (string, error) {
+	if runtime.GOOS != "darwin" {
+		return "", errors.New("safari bookmarks are only available on macOS, provide path to Bookmarks.plist file with --input flag")
+	}
+	p, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(p, `Library/Safari/Bookmarks.plist`), nil
+}
+
+// safariSource returns source reading Safari Bookmarks.plist file.
+func safariSource(path string) bookmarksSource {
+	src := fileSource("Safari", path)
+	src.parse = parseSafariBookmarks
+	return src
+}
+
+// parseSafariBookmarks converts Safari bookmarks property list (either XML or
+// binary) to bookmarks. Every top level list (bookmarks bar, menu, reading
+// list) becomes a separate root, top level bookmarks are placed in "other"
+// root.
+func parseSafariBookmarks(data []byte, bookmarksFile string) (*bookmarks, error) {
+	v, err := decodePlist(data)
+	if err != nil {
+		return nil, &exitError{exitParse, fmt.Errorf("bookmarks file %s: %w", bookmarksFile, err)}
+	}
+	top, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, &exitError{exitParse, fmt.Errorf("bookmarks file %s: expected dictionary at the top level", bookmarksFile)}
+	}
+
+	res := &bookmarks{Version: 1, Roots: map[string]*bookmarksEntry{}}
+	other := &bookmarksEntry{Name: "Other bookmarks", Type: "folder"}
+	for _, c := range plistArray(top["Children"]) {
+		e := safariEntry(c)
+		if e == nil {
+			continue
+		}
+		if isUrlEntry(e) {
+			other.Children = append(other.Children, e)
+			continue
+		}
+		key := e.Name
+		switch key {
+		case "BookmarksBar":
+			key, e.Name = "bookmark_bar", "Favorites"
+		case "BookmarksMenu":
+			e.Name = "Bookmarks Menu"
+		case "com.apple.ReadingList":
+			e.Name = "Reading List"
+		}
+		res.Roots[key] = e
+		res.order = append(res.order, key)
+	}
+	if len(other.Children) != 0 {
+		res.Roots["other"] = other
+		res.order = append(res.order, "other")
+	}
+	return res, nil
+}
+
+func safariEntry(v interface{}) *bookmarksEntry {
+	d, ok := v.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	switch plistString(d["WebBookmarkType"]) {
+	case "WebBookmarkTypeList":
+		e := &bookmarksEntry{Name: plistString(d["Title"]), Type: "folder", Guid: plistString(d["WebBookmarkUUID"])}
+		for _, c := range plistArray(d["Children"]) {
+			if ce := safariEntry(c); ce != nil {
+				e.Children = append(e.Children, ce)
+			}
+		}
+		return e
+	case "WebBookmarkTypeLeaf":
+		name := ""
+		if uri, ok := d["URIDictionary"].(map[string]interface{}); ok {
+			name = plistString(uri["title"])
+		}
+		return &bookmarksEntry{Name: name, Type: "url", Url: plistString(d["URLString"]), Guid: plistString(d["WebBookmarkUUID"])}
+	default: // proxies (like history) and unknown entries
+		return nil
+	}
+}
+
+func plistString(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+func plistArray(v interface{}) []interface{} {
+	a, _ := v.([]interface{})
+	return a
+}
+
+// decodePlist decodes XML or binary property list. Values are decoded to
+// map[string]interface{}, []interface{}, string, int64, float64, bool and
+// []byte. Dates are decoded as strings.
+func decodePlist(data []byte) (interface{}, error) {
+	if bytes.HasPrefix(data, []byte("bplist00")) {
+		return decodeBinaryPlist(data)
+	}
+	return decodeXMLPlist(data)
+}
+
+func decodeXMLPlist(data []byte) (interface{}, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		t, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				return nil, errors.New("plist: no value found")
+			}
+			return nil, err
+		}
+		if se, ok := t.(xml.StartElement); ok && se.Name.Local != "plist" {
+			return decodeXMLPlistValue(d, se)
+		}
+	}
+}
+
+func decodeXMLPlistValue(d *xml.Decoder, se xml.StartElement) (interface{}, error) {
+	switch se.Name.Local {
+	case "dict":
+		res := map[string]interface{}{}
+		key := ""
+		for {
+			t, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := t.(type) {
+			case xml.StartElement:
+				if t.Name.Local == "key" {
+					if err := d.DecodeElement(&key, &t); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				v, err := decodeXMLPlistValue(d, t)
+				if err != nil {
+					return nil, err
+				}
+				res[key] = v
+			case xml.EndElement:
+				return res, nil
+			}
+		}
+	case "array":
+		res := []interface{}{}
+		for {
+			t, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := t.(type) {
+			case xml.StartElement:
+				v, err := decodeXMLPlistValue(d, t)
+				if err != nil {
+					return nil, err
+				}
+				res = append(res, v)
+			case xml.EndElement:
+				return res, nil
+			}
+		}
+	case "true", "false":
+		if err := d.Skip(); err != nil {
+			return nil, err
+		}
+		return se.Name.Local == "true", nil
+	}
+
+	text := ""
+	if err := d.DecodeElement(&text, &se); err != nil {
+		return nil, err
+	}
+	switch se.Name.Local {
+	case "string", "date":
+		return text, nil
+	case "integer":
+		return strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+	case "real":
+		return strconv.ParseFloat(strings.TrimSpace(text), 64)
+	case "data":
+		return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+	default:
+		return nil, fmt.Errorf("plist: unknown element %q", se.Name.Local)
+	}
+}
+
+// binaryPlist holds state of binary property list decoding.
+type binaryPlist struct {
+	data       []byte
+	offsets    []uint64
+	refSize    int
+	inProgress map[uint64]bool // objects being decoded, to detect cycles
+}
+
+func decodeBinaryPlist(data []byte) (interface{}, error) {
+	if len(data) < 8+32 {
+		return nil, errors.New("plist: binary property list too short")
+	}
+	trailer := data[len(data)-32:]
+	offsetSize := int(trailer[6])
+	refSize := int(trailer[7])
+	numObjects := binary.BigEndian.Uint64(trailer[8:])
+	topObject := binary.BigEndian.Uint64(trailer[16:])
+	tableOffset := binary.BigEndian.Uint64(trailer[24:])
+	if offsetSize < 1 || offsetSize > 8 || refSize < 1 || refSize > 8 || numObjects > uint64(len(data)) || tableOffset > uint64(len(data)) || numObjects*uint64(offsetSize) > uint64(len(data))-tableOffset {
+		return nil, errors.New("plist: malformed binary property list trailer")
+	}
+
+	p := &binaryPlist{data: data, refSize: refSize, inProgress: map[uint64]bool{}}
+	for i := uint64(0); i < numObjects; i++ {
+		o := tableOffset + i*uint64(offsetSize)
+		p.offsets = append(p.offsets, readUint(data[o:o+uint64(offsetSize)]))
+	}
+	return p.object(topObject)
+}
+
+func readUint(b []byte) uint64 {
+	res := uint64(0)
+	for _, c := range b {
+		res = res<<8 | uint64(c)
+	}
+	return res
+}
+
+func (p *binaryPlist) object(ref uint64) (interface{}, error) {
+	if ref >= uint64(len(p.offsets)) || p.offsets[ref] >= uint64(len(p.data)) {
+		return nil, fmt.Errorf("plist: invalid object reference %d", ref)
+	}
+	if p.inProgress[ref] {
+		return nil, fmt.Errorf("plist: cyclic object reference %d", ref)
+	}
+	p.inProgress[ref] = true
+	defer delete(p.inProgress, ref)
+
+	o := p.offsets[ref]
+	marker := p.data[o]
+	kind, info := marker>>4, uint64(marker&0x0f)
+	o++
+
+	switch kind {
+	case 0x0:
+		switch info {
+		case 0x8:
+			return false, nil
+		case 0x9:
+			return true, nil
+		default:
+			return nil, nil
+		}
+	case 0x1:
+		b, err := p.bytes(o, 1<<info)
+		if err != nil {
+			return nil, err
+		}
+		return int64(readUint(b)), nil
+	case 0x2:
+		b, err := p.bytes(o, 1<<info)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) == 4 {
+			return float64(math.Float32frombits(uint32(readUint(b)))), nil
+		}
+		return math.Float64frombits(readUint(b)), nil
+	case 0x3:
+		b, err := p.bytes(o, 8)
+		if err != nil {
+			return nil, err
+		}
+		return strconv.FormatFloat(math.Float64frombits(readUint(b)), 'f', -1, 64), nil
+	}
+
+	n, o, err := p.length(info, o)
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case 0x4:
+		return p.bytes(o, n)
+	case 0x5:
+		b, err := p.bytes(o, n)
+		return string(b), err
+	case 0x6:
+		if n > uint64(len(p.data))/2 {
+			return nil, errors.New("plist: unexpected end of data")
+		}
+		b, err := p.bytes(o, n*2)
+		if err != nil {
+			return nil, err
+		}
+		u := make([]uint16, n)
+		for i := range u {
+			u[i] = binary.BigEndian.Uint16(b[i*2:])
+		}
+		return string(utf16.Decode(u)), nil
+	case 0xa:
+		refs, err := p.refs(o, n)
+		if err != nil {
+			return nil, err
+		}
+		res := make([]interface{}, 0, n)
+		for _, r := range refs {
+			v, err := p.object(r)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, v)
+		}
+		return res, nil
+	case 0xd:
+		if n > uint64(len(p.data))/uint64(2*p.refSize) {
+			return nil, errors.New("plist: unexpected end of data")
+		}
+		refs, err := p.refs(o, n*2)
+		if err != nil {
+			return nil, err
+		}
+		res := make(map[string]interface{}, n)
+		for i := uint64(0); i < n; i++ {
+			k, err := p.object(refs[i])
+			if err != nil {
+				return nil, err
+			}
+			v, err := p.object(refs[n+i])
+			if err != nil {
+				return nil, err
+			}
+			ks, ok := k.(string)
+			if !ok {
+				return nil, errors.New("plist: dictionary key is not a string")
+			}
+			res[ks] = v
+		}
+		return res, nil
+	default:
+		return nil, fmt.Errorf("plist: unsupported object type 0x%x", kind)
+	}
+}
+
+// length returns length of an object with the given marker info, reading
+// extended length when needed, and offset of the object content.
+func (p *binaryPlist) length(info, o uint64) (uint64, uint64, error) {
+	if info != 0x0f {
+		return info, o, nil
+	}
+	if o >= uint64(len(p.data)) {
+		return 0, 0, errors.New("plist: unexpected end of data")
+	}
+	size := uint64(1) << (p.data[o] & 0x0f)
+	b, err := p.bytes(o+1, size)
+	if err != nil {
+		return 0, 0, err
+	}
+	return readUint(b), o + 1 + size, nil
+}
+
+func (p *binaryPlist) bytes(o, n uint64) ([]byte, error) {
+	if o > uint64(len(p.data)) || n > uint64(len(p.data))-o {
+		return nil, errors.New("plist: unexpected end of data")
+	}
+	return p.data[o : o+n], nil
+}
+
+func (p *binaryPlist) refs(o, n uint64) ([]uint64, error) {
+	if n > uint64(len(p.data)) {
+		return nil, errors.New("plist: unexpected end of data")
+	}
+	b, err := p.bytes(o, n*uint64(p.refSize))
+	if err != nil {
+		return nil, err
+	}
+	res := make([]uint64, n)
+	for i := range res {
+		res[i] = readUint(b[i*p.refSize : (i+1)*p.refSize])
+	}
+	return res, nil
+}
@@ -0,0 +1,215 @@
+// Copyright 2022 Marek Dalewski
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+const testSafariBookmarks = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Children</key>
+	<array>
+		<dict>
+			<key>Title</key><string>History</string>
+			<key>WebBookmarkType</key><string>WebBookmarkTypeProxy</string>
+		</dict>
+		<dict>
+			<key>Title</key><string>BookmarksBar</string>
+			<key>WebBookmarkType</key><string>WebBookmarkTypeList</string>
+			<key>Children</key>
+			<array>
+				<dict>
+					<key>URIDictionary</key><dict><key>title</key><string>Go</string></dict>
+					<key>URLString</key><string>https://go.dev/</string>
+					<key>WebBookmarkType</key><string>WebBookmarkTypeLeaf</string>
+					<key>WebBookmarkUUID</key><string>u1</string>
+				</dict>
+				<dict>
+					<key>Title</key><string>Docs</string>
+					<key>WebBookmarkType</key><string>WebBookmarkTypeList</string>
+					<key>Children</key><array/>
+				</dict>
+			</array>
+		</dict>
+		<dict>
+			<key>Title</key><string>BookmarksMenu</string>
+			<key>WebBookmarkType</key><string>WebBookmarkTypeList</string>
+		</dict>
+		<dict>
+			<key>URIDictionary</key><dict><key>title</key><string>Example</string></dict>
+			<key>URLString</key><string>https://example.com/</string>
+			<key>WebBookmarkType</key><string>WebBookmarkTypeLeaf</string>
+		</dict>
+		<dict>
+			<key>Title</key><string>com.apple.ReadingList</string>
+			<key>WebBookmarkType</key><string>WebBookmarkTypeList</string>
+			<key>Sync</key><dict><key>Deleted</key><false/><key>Count</key><integer>2</integer></dict>
+		</dict>
+	</array>
+</dict>
+</plist>
+`
+
+func TestParseSafariBookmarks(t *testing.T) {
+	b, err := parseSafariBookmarks([]byte(testSafariBookmarks), "Bookmarks.plist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"bookmark_bar", "BookmarksMenu", "com.apple.ReadingList", "other"}; !reflect.DeepEqual(rootKeys(b), want) {
+		t.Errorf("parseSafariBookmarks() roots = %q, want %q", rootKeys(b), want)
+	}
+	if got, want := treeString(rootEntries(b)), "Favorites(Go Docs) Bookmarks Menu Reading List Other bookmarks(Example)"; got != want {
+		t.Errorf("parseSafariBookmarks() = %s, want %s", got, want)
+	}
+	if got := b.Roots["bookmark_bar"].Children[0]; got.Url != "https://go.dev/" || got.Guid != "u1" || !isUrlEntry(got) {
+		t.Errorf("parseSafariBookmarks() bookmark = %+v", got)
+	}
+}
+
+func TestParseSafariBookmarksErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"XML syntax", []byte("<plist><dict><key>Children</key><array>")},
+		{"unknown element", []byte("<plist><dict><key>Children</key><set/></dict></plist>")},
+		{"no value", []byte("<plist></plist>")},
+		{"not a dictionary", []byte("<plist><array/></plist>")},
+		{"binary too short", []byte("bplist00")},
+		{"binary overflowing length", binaryPlistData([]byte{0x6f, 0x13, 0x80, 0, 0, 0, 0, 0, 0, 0})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseSafariBookmarks(tt.data, "Bookmarks.plist")
+			if err == nil {
+				t.Fatal("parseSafariBookmarks() succeeded")
+			}
+			if code := exitCode(err); code != exitParse {
+				t.Errorf("exitCode(%v) = %d, want %d", err, code, exitParse)
+			}
+		})
+	}
+}
+
+func TestDecodeXMLPlist(t *testing.T) {
+	tests := []struct {
+		data string
+		want interface{}
+	}{
+		{"<plist><string>a &amp; b</string></plist>", "a & b"},
+		{"<plist><integer> -42 </integer></plist>", int64(-42)},
+		{"<plist><real>2.5</real></plist>", 2.5},
+		{"<plist><true/></plist>", true},
+		{"<plist><false/></plist>", false},
+		{"<plist><date>2022-06-18T04:26:40Z</date></plist>", "2022-06-18T04:26:40Z"},
+		{"<plist><data>\n\taGVs\n\tbG8=\n</data></plist>", []byte("hello")},
+		{"<plist><array><string>a</string><array/></array></plist>", []interface{}{"a", []interface{}{}}},
+		{"<plist><dict><key>a</key><integer>1</integer><key>b</key><dict/></dict></plist>", map[string]interface{}{"a": int64(1), "b": map[string]interface{}{}}},
+	}
+	for _, tt := range tests {
+		got, err := decodePlist([]byte(tt.data))
+		if err != nil {
+			t.Errorf("decodePlist(%q) error = %v", tt.data, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("decodePlist(%q) = %#v, want %#v", tt.data, got, tt.want)
+		}
+	}
+}
+
+// binaryPlistData returns binary property list with the given encoded objects,
+// the first one being the top object. Offsets and references are one byte
+// long.
+func binaryPlistData(objects ...[]byte) []byte {
+	data := []byte("bplist00")
+	offsets := []byte(nil)
+	for _, o := range objects {
+		offsets = append(offsets, byte(len(data)))
+		data = append(data, o...)
+	}
+	tableOffset := len(data)
+	data = append(data, offsets...)
+	trailer := make([]byte, 32)
+	trailer[6], trailer[7] = 1, 1
+	binary.BigEndian.PutUint64(trailer[8:], uint64(len(objects)))
+	binary.BigEndian.PutUint64(trailer[24:], uint64(tableOffset))
+	return append(data, trailer...)
+}
+
+func TestDecodeBinaryPlist(t *testing.T) {
+	tests := []struct {
+		name    string
+		objects [][]byte
+		want    interface{}
+	}{
+		{"ASCII string", [][]byte{{0x52, 'G', 'o'}}, "Go"},
+		{"UTF-16 string", [][]byte{{0x62, 0x00, 'G', 0x01, 0x7c}}, "Gż"},
+		{"extended length string", [][]byte{append([]byte{0x5f, 0x10, 16}, "0123456789abcdef"...)}, "0123456789abcdef"},
+		{"integer", [][]byte{{0x11, 0x01, 0x00}}, int64(256)},
+		{"real", [][]byte{{0x23, 0x40, 0x04, 0, 0, 0, 0, 0, 0}}, 2.5},
+		{"booleans", [][]byte{{0xa2, 1, 2}, {0x09}, {0x08}}, []interface{}{true, false}},
+		{"data", [][]byte{{0x42, 0xca, 0xfe}}, []byte{0xca, 0xfe}},
+		{"dictionary", [][]byte{{0xd1, 1, 2}, {0x55, 'T', 'i', 't', 'l', 'e'}, {0x52, 'G', 'o'}}, map[string]interface{}{"Title": "Go"}},
+		{"shared object", [][]byte{{0xa2, 1, 1}, {0x51, 'a'}}, []interface{}{"a", "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodePlist(binaryPlistData(tt.objects...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodePlist() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeBinaryPlistMalformed(t *testing.T) {
+	overflow := []byte{0x13, 0x80, 0, 0, 0, 0, 0, 0, 0} // extended length 2^63
+	malformedTrailer := binaryPlistData([]byte{0x09})
+	malformedTrailer[len(malformedTrailer)-26] = 0 // offset size
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"too short", []byte("bplist00")},
+		{"malformed trailer", malformedTrailer},
+		{"overflowing UTF-16 string length", binaryPlistData(append([]byte{0x6f}, overflow...))},
+		{"overflowing dictionary length", binaryPlistData(append([]byte{0xdf}, overflow...))},
+		{"overflowing array length", binaryPlistData(append([]byte{0xaf}, overflow...))},
+		{"overflowing string length", binaryPlistData(append([]byte{0x5f}, overflow...))},
+		{"overflowing data length", binaryPlistData(append([]byte{0x4f}, overflow...))},
+		{"huge length size", binaryPlistData([]byte{0x5f, 0x1f, 0x01})},
+		{"missing length", binaryPlistData([]byte{0x5f})},
+		{"invalid reference", binaryPlistData([]byte{0xa1, 0x05})},
+		{"cyclic reference", binaryPlistData([]byte{0xa1, 0x00})},
+		{"non string key", binaryPlistData([]byte{0xd1, 1, 1}, []byte{0x10, 0x01})},
+		{"unsupported type", binaryPlistData([]byte{0x80})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if v, err := decodePlist(tt.data); err == nil {
+				t.Errorf("decodePlist() = %#v, want error", v)
+			}
+		})
+	}
+}
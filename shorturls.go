@@ -0,0 +1,107 @@
+// Copyright 2022 Marek Dalewski
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// shortenerHosts lists hosts of well known URL shortening services.
+var shortenerHosts = []string{
+	"bit.ly", "buff.ly", "cutt.ly", "goo.gl", "is.gd", "lnkd.in", "ow.ly", "rebrand.ly", "shorturl.at", "t.co", "tiny.cc", "tinyurl.com",
+}
+
+// urlExpander replaces short links with URLs they redirect to.
+type urlExpander struct {
+	hosts       map[string]bool
+	client      *http.Client
+	concurrency int
+	shared      limiter // global limit of concurrent operations
+}
+
+// newUrlExpander returns expander for well known shortener hosts and the
+// given extra hosts.
+func newUrlExpander(extraHosts []string, concurrency int, timeout time.Duration, shared limiter) (*urlExpander, error) {
+	if concurrency < 1 {
+		return nil, fmt.Errorf("expand concurrency must be positive, got %d", concurrency)
+	}
+	hosts := map[string]bool{}
+	for _, h := range append(shortenerHosts[:len(shortenerHosts):len(shortenerHosts)], extraHosts...) {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			hosts[h] = true
+		}
+	}
+	return &urlExpander{hosts: hosts, client: &http.Client{Timeout: timeout}, concurrency: concurrency, shared: shared}, nil
+}
+
+// run expands URLs of all bookmarks of the given profiles pointing at
+// shortener hosts, running at most concurrency requests at once. Bookmarks
+// which URLs cannot be expanded keep their original URLs. Returns number of
+// failed expansions.
+func (x *urlExpander) run(profiles []*profile) int {
+	entries := []*bookmarksEntry(nil)
+	for _, p := range profiles {
+		walkBookmarks(p.bookmarks, func(e *bookmarksEntry, depth int) {
+			if isUrlEntry(e) && x.hosts[strings.ToLower(urlHost(e.Url))] {
+				entries = append(entries, e)
+			}
+		})
+	}
+
+	mu, failed := sync.Mutex{}, 0
+	wg, sem := sync.WaitGroup{}, make(chan struct{}, x.concurrency)
+	for _, e := range entries {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(e *bookmarksEntry) {
+			defer func() { <-sem; wg.Done() }()
+			x.shared.acquire()
+			expanded, err := x.expand(e.Url)
+			x.shared.release()
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed++
+				reportWarning(fmt.Sprintf("expanding %s failed, original URL is kept: %v", e.Url, err))
+				return
+			}
+			e.Url = expanded
+		}(e)
+	}
+	wg.Wait()
+	return failed
+}
+
+// expand returns the final URL the given one redirects to, found with HEAD
+// request.
+func (x *urlExpander) expand(rawUrl string) (string, error) {
+	req, err := http.NewRequest(http.MethodHead, rawUrl, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := x.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return "", fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+	return resp.Request.URL.String(), nil
+}
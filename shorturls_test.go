@@ -0,0 +1,90 @@
+// Copyright 2022 Marek Dalewski
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUrlExpander(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/s/go":
+			http.Redirect(w, r, "/s/hop", http.StatusMovedPermanently)
+		case "/s/hop":
+			http.Redirect(w, r, "/destination?from=short", http.StatusFound)
+		case "/destination":
+			if r.Method != http.MethodHead {
+				t.Errorf("expand used %s request, want HEAD", r.Method)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	data := `{"version": 1, "roots": {"other": {"name": "Other", "type": "folder", "children": [
+		{"name": "Short", "type": "url", "url": "` + srv.URL + `/s/go"},
+		{"name": "Missing", "type": "url", "url": "` + srv.URL + `/s/missing"},
+		{"name": "Go", "type": "url", "url": "https://go.dev/"}
+	]}}}`
+	p := testProfile(t, "Default", data)
+	x, err := newUrlExpander([]string{" 127.0.0.1 ", ""}, 2, 5*time.Second, newLimiter(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := 0
+	warnings := captureStderr(t, func() { failed = x.run([]*profile{p}) })
+	if failed != 1 {
+		t.Errorf("run() = %d failures, want 1", failed)
+	}
+	if got := lines(warnings); len(got) != 1 || !strings.Contains(got[0], "/s/missing failed, original URL is kept: unexpected response status 404") {
+		t.Errorf("run() reported %q, want failure of /s/missing", got)
+	}
+	got := []string(nil)
+	for _, e := range p.bookmarks.Roots["other"].Children {
+		got = append(got, e.Url)
+	}
+	if want := []string{srv.URL + "/destination?from=short", srv.URL + "/s/missing", "https://go.dev/"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("run() URLs = %q, want %q", got, want)
+	}
+}
+
+func TestUrlExpanderHosts(t *testing.T) {
+	wellKnown := append([]string(nil), shortenerHosts...)
+	x, err := newUrlExpander([]string{"Go.Example"}, 1, time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range []string{"bit.ly", "t.co", "go.example"} {
+		if !x.hosts[h] {
+			t.Errorf("expander does not handle host %s", h)
+		}
+	}
+	if x.hosts["go.dev"] {
+		t.Error("expander handles host go.dev")
+	}
+	if !reflect.DeepEqual(shortenerHosts, wellKnown) {
+		t.Errorf("newUrlExpander() modified list of well known hosts: %q", shortenerHosts)
+	}
+	if _, err := newUrlExpander(nil, 0, time.Second, nil); err == nil {
+		t.Error("newUrlExpander() succeeded for zero concurrency")
+	}
+}
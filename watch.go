@@ -0,0 +1,147 @@
+// Copyright 2022 Marek Dalewski
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"time"
+)
+
+// watchFlags lists flags controlling watch mode, not passed to conversion
+// runs.
+var watchFlags = map[string]bool{"watch": true, "watch-interval": true, "watch-debounce": true}
+
+// fileState identifies version of a watched file.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// watcher regenerates the output whenever any of the watched files changes.
+// Files are polled, so that no platform specific notification mechanisms are
+// needed.
+type watcher struct {
+	paths    []string
+	interval time.Duration // polling interval
+	debounce time.Duration // quiet period required before regenerating
+	convert  func()        // runs a single conversion
+}
+
+// newWatcher returns watcher of the given local bookmarks sources.
+func newWatcher(sources []bookmarksSource, interval, debounce time.Duration) (*watcher, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("watch interval must be positive, got %s", interval)
+	}
+	if debounce < 0 {
+		return nil, fmt.Errorf("watch debounce must not be negative, got %s", debounce)
+	}
+	w := &watcher{interval: interval, debounce: debounce, convert: func() { convertNow(convertArgs()) }}
+	for _, src := range sources {
+		if !src.local {
+			return nil, fmt.Errorf("--watch supports only bookmarks files on local file system, got %s", src.path)
+		}
+		w.paths = append(w.paths, src.origin)
+	}
+	if len(w.paths) == 0 {
+		return nil, errors.New("--watch found no bookmarks files to watch")
+	}
+	return w, nil
+}
+
+// state returns current state of all watched files. Missing files (like ones
+// being replaced by Chrome) have zero state.
+func (w *watcher) state() []fileState {
+	res := make([]fileState, len(w.paths))
+	for i, p := range w.paths {
+		if fi, err := os.Stat(p); err == nil {
+			res[i] = fileState{fi.ModTime(), fi.Size()}
+		}
+	}
+	return res
+}
+
+func sameState(a, b []fileState) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// run converts bookmarks once and then again after every change of watched
+// files, until interrupted. Chrome rewrites bookmarks files frequently, so
+// conversion starts only once files stay unchanged for the debounce period.
+// Every conversion runs this program again with the same flags (except watch
+// ones), so that a failing conversion does not stop watching.
+func (w *watcher) run() error {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	return w.loop(interrupt)
+}
+
+// loop does the work of run, until stop receives a value.
+func (w *watcher) loop(stop <-chan os.Signal) error {
+	last := w.state()
+	w.convert()
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	changedAt := time.Time{}
+	for {
+		select {
+		case <-stop:
+			return nil
+		case now := <-ticker.C:
+			if current := w.state(); !sameState(current, last) {
+				last, changedAt = current, now
+				continue
+			}
+			if !changedAt.IsZero() && now.Sub(changedAt) >= w.debounce {
+				changedAt = time.Time{}
+				w.convert()
+			}
+		}
+	}
+}
+
+// convertArgs returns command line arguments of a single conversion run.
+func convertArgs() []string {
+	args := []string(nil)
+	flag.Visit(func(f *flag.Flag) {
+		if !watchFlags[f.Name] {
+			args = append(args, "-"+f.Name+"="+f.Value.String())
+		}
+	})
+	return append(args, flag.Args()...)
+}
+
+// convertNow runs a single conversion, reporting its failure.
+func convertNow(args []string) {
+	self, err := os.Executable()
+	if reportError(err) {
+		return
+	}
+	cmd := exec.Command(self, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		reportError(fmt.Errorf("conversion failed: %w", err))
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2022 Marek Dalewski
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewWatcher(t *testing.T) {
+	local := fileSource("Default", "Bookmarks")
+	tests := []struct {
+		name     string
+		sources  []bookmarksSource
+		interval time.Duration
+		debounce time.Duration
+		wantErr  bool
+	}{
+		{"local file", []bookmarksSource{local}, time.Second, 0, false},
+		{"stdin", []bookmarksSource{stdinSource()}, time.Second, 0, true},
+		{"no sources", nil, time.Second, 0, true},
+		{"zero interval", []bookmarksSource{local}, 0, 0, true},
+		{"negative debounce", []bookmarksSource{local}, time.Second, -time.Second, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := newWatcher(tt.sources, tt.interval, tt.debounce)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newWatcher() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (len(w.paths) != 1 || w.paths[0] != local.origin) {
+				t.Errorf("newWatcher() paths = %v, want [%s]", w.paths, local.origin)
+			}
+		})
+	}
+}
+
+func TestWatcherRegeneratesOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Bookmarks")
+	if err := os.WriteFile(path, []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := newWatcher([]bookmarksSource{fileSource("Default", path)}, 5*time.Millisecond, 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	converted := make(chan struct{}, 10)
+	w.convert = func() { converted <- struct{}{} }
+	stop := make(chan os.Signal)
+	done := make(chan error)
+	go func() { done <- w.loop(stop) }()
+
+	wait := func(what string) {
+		t.Helper()
+		select {
+		case <-converted:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no conversion %s", what)
+		}
+	}
+	wait("at start")
+	select {
+	case <-converted:
+		t.Fatal("conversion without change")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := os.WriteFile(path, []byte(`{"roots": {}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	wait("after change")
+
+	close(stop)
+	if err := <-done; err != nil {
+		t.Errorf("loop() error = %v", err)
+	}
+}